@@ -0,0 +1,324 @@
+package mathpix
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxCachedReader is the size of the largest image read from a Reader
+// that is cached. Image data is buffered in memory to be hashed, so larger
+// images are sent without using the cache.
+const maxCachedReader = 32 << 20
+
+type (
+	// Cache stores responses of the Image and RequestStrokes calls keyed by
+	// a hash of their input.
+	//
+	// It is implemented by MemoryCache and DirCache, and can be implemented
+	// on top of key-value stores such as Redis.
+	Cache interface {
+		// Get returns the value stored under key and whether it was found.
+		Get(ctx context.Context, key string) ([]byte, bool, error)
+		// Set stores value under key. A positive ttl makes the value expire
+		// after that duration.
+		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	}
+	// MemoryCache is an in-memory Cache evicting the least recently used
+	// values once full.
+	//
+	// It is safe for concurrent use.
+	MemoryCache struct {
+		mu       sync.Mutex
+		capacity int
+		order    *list.List
+		entries  map[string]*list.Element
+	}
+	// DirCache is a Cache storing values as files in a directory.
+	//
+	// Expired files are removed when they are read.
+	DirCache struct {
+		dir string
+	}
+	// cacheEntry is a value stored in a MemoryCache.
+	cacheEntry struct {
+		key     string
+		value   []byte
+		expires time.Time
+	}
+	// skipCacheKey is the context key marking calls that skip the cache.
+	skipCacheKey struct{}
+)
+
+// WithCache caches the responses of the Image and RequestStrokes calls in
+// cache for ttl. A zero or negative ttl caches responses until they are
+// evicted.
+//
+// Responses are keyed by a hash of the image data or URL and the request
+// options, so that identical requests are only sent once. Only successful
+// responses are cached. Images read from a Reader are buffered in memory to
+// be hashed, and are not cached if larger than 32 MiB.
+func WithCache(cache Cache, ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.cache = cache
+		c.cacheTTL = ttl
+	}
+}
+
+// SkipCache returns a context making the calls it is used for bypass the
+// cache set with WithCache: responses are neither read from nor written to
+// it.
+func SkipCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCacheKey{}, true)
+}
+
+// NewMemoryCache creates a new MemoryCache holding at most capacity values.
+// A zero or negative capacity holds an unlimited number of values.
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored under key.
+func (m *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		m.order.Remove(el)
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+// Set stores value under key, evicting the least recently used value if
+// the cache is full.
+func (m *MemoryCache) Set(
+	_ context.Context,
+	key string,
+	value []byte,
+	ttl time.Duration,
+) error {
+	entry := &cacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		el.Value = entry
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	if m.capacity > 0 && m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of values in the cache, including expired values
+// not yet removed.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// NewDirCache creates a new DirCache storing values in dir.
+//
+// The directory is created when the first value is stored.
+func NewDirCache(dir string) *DirCache {
+	return &DirCache{dir: dir}
+}
+
+// Get returns the value stored under key.
+//
+// Files start with the expiry of the value in unix nanoseconds, zero for
+// values that never expire, followed by a newline and the value.
+func (d *DirCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	b, err := os.ReadFile(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	header, value, ok := bytes.Cut(b, []byte("\n"))
+	if !ok {
+		return nil, false, errors.New("mathpix: corrupt cache file " + key)
+	}
+	expires, err := strconv.ParseInt(string(header), 10, 64)
+	if err != nil {
+		return nil, false, err
+	}
+	if expires != 0 && time.Now().UnixNano() > expires {
+		return nil, false, os.Remove(d.path(key))
+	}
+	return value, true, nil
+}
+
+// Set stores value under key.
+//
+// Values are written to a temporary file first, so that concurrent readers
+// never see a partial value.
+func (d *DirCache) Set(
+	_ context.Context,
+	key string,
+	value []byte,
+	ttl time.Duration,
+) error {
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UnixNano()
+	}
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(d.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strconv.FormatInt(expires, 10) + "\n")
+	if err == nil {
+		_, err = f.Write(value)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), d.path(key))
+}
+
+// path returns the path of the file storing key.
+func (d *DirCache) path(key string) string {
+	return filepath.Join(d.dir, key)
+}
+
+// caching reports whether the calls made with ctx use the cache.
+func (c *Client) caching(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipCacheKey{}).(bool)
+	return c.cache != nil && !skip
+}
+
+// cached returns the response cached under key, or calls fetch and caches
+// its response if it succeeds.
+//
+// Cache failures are logged and never fail the call.
+func cached[Response any](
+	ctx context.Context,
+	c *Client,
+	key string,
+	fetch func() (Response, error),
+) (Response, error) {
+	var response Response
+	b, ok, err := c.cache.Get(ctx, key)
+	if err != nil {
+		c.logCacheError(ctx, err)
+	}
+	if ok && json.Unmarshal(b, &response) == nil {
+		return response, nil
+	}
+	response, err = fetch()
+	if err != nil {
+		return response, err
+	}
+	if b, err = json.Marshal(response); err == nil {
+		err = c.cache.Set(ctx, key, b, c.cacheTTL)
+	}
+	if err != nil {
+		c.logCacheError(ctx, err)
+	}
+	return response, nil
+}
+
+// logCacheError logs a cache failure.
+func (c *Client) logCacheError(ctx context.Context, err error) {
+	if c.logger != nil {
+		c.logger.LogAttrs(
+			ctx,
+			slog.LevelWarn,
+			"mathpix cache error",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// imageCacheKey returns the cache key of an image request.
+//
+// Image data read from the request's Reader is buffered, so the returned
+// request must be sent instead of the original one. The key is empty if
+// the data is larger than maxCachedReader and must not be cached.
+func imageCacheKey(request *ImageRequest) (*ImageRequest, string, error) {
+	h := sha256.New()
+	switch {
+	case request.Reader != nil:
+		data, err := io.ReadAll(
+			io.LimitReader(request.Reader, maxCachedReader+1),
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		buffered := *request
+		buffered.Reader = bytes.NewReader(data)
+		if len(data) > maxCachedReader {
+			buffered.Reader = io.MultiReader(buffered.Reader, request.Reader)
+			return &buffered, "", nil
+		}
+		request = &buffered
+		h.Write(data)
+	case request.File != "":
+		f, err := os.Open(request.File)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		if _, err = io.Copy(h, f); err != nil {
+			return nil, "", err
+		}
+	}
+	opts := *request
+	if request.Reader != nil || request.File != "" {
+		// Uploads ignore the source URL.
+		opts.SourceURL = ""
+	}
+	return request, cacheKey(h, imagesEndpoint.name, &opts), nil
+}
+
+// cacheKey completes h with the endpoint name and the JSON encoded request
+// options and returns its hex encoded sum.
+func cacheKey(h hash.Hash, endpoint string, options any) string {
+	opts, _ := json.Marshal(options)
+	h.Write([]byte{0})
+	io.WriteString(h, endpoint)
+	h.Write([]byte{0})
+	h.Write(opts)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,182 @@
+package mathpix_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	cache := mathpix.NewMemoryCache(2)
+	for _, key := range []string{"a", "b"} {
+		if err := cache.Set(ctx, key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Reading a makes b the least recently used value.
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatal("a not found")
+	}
+	if err := cache.Set(ctx, "c", []byte("c"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := cache.Len(); n != 2 {
+		t.Errorf("got %d values, want 2", n)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := cache.Get(ctx, key); ok != want {
+			t.Errorf("got %s found %t, want %t", key, ok, want)
+		}
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache := mathpix.NewMemoryCache(0)
+	if err := cache.Set(ctx, "short", []byte("v"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(ctx, "forever", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok, _ := cache.Get(ctx, "short"); ok {
+		t.Error("expired value found")
+	}
+	if _, ok, _ := cache.Get(ctx, "forever"); !ok {
+		t.Error("value without ttl not found")
+	}
+	if n := cache.Len(); n != 1 {
+		t.Errorf("got %d values, want the expired one removed", n)
+	}
+}
+
+func TestDirCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache := mathpix.NewDirCache(dir)
+	if err := cache.Set(ctx, "short", []byte("v"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(ctx, "forever", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok, err := cache.Get(ctx, "short"); ok || err != nil {
+		t.Errorf("got found %t and error %v for an expired value", ok, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "short")); !os.IsNotExist(err) {
+		t.Errorf("expired file not removed: %v", err)
+	}
+	value, ok, err := cache.Get(ctx, "forever")
+	if err != nil || !ok || string(value) != "v" {
+		t.Errorf("got %q, %t, %v, want the value without ttl", value, ok, err)
+	}
+}
+
+func TestDirCacheAtomicWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cache := mathpix.NewDirCache(dir)
+	values := [][]byte{
+		bytes.Repeat([]byte("a"), 1<<16),
+		bytes.Repeat([]byte("b"), 1<<16),
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := cache.Set(ctx, "key", values[i%2], 0); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			value, ok, err := cache.Get(ctx, "key")
+			if err != nil {
+				t.Error(err)
+			}
+			if ok && !bytes.Equal(value, values[0]) && !bytes.Equal(value, values[1]) {
+				t.Errorf("read a partial value of %d bytes", len(value))
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	client := srv.Client(mathpix.WithCache(mathpix.NewMemoryCache(0), 0))
+	ctx := context.Background()
+	// Maps are encoded with sorted keys, whatever order they are built in.
+	requests := []*mathpix.ImageRequest{
+		{
+			SourceURL: "https://example.com/eq.png",
+			Metadata:  map[string]string{"a": "1", "b": "2", "c": "3"},
+		},
+		{
+			SourceURL: "https://example.com/eq.png",
+			Metadata:  map[string]string{"c": "3", "b": "2", "a": "1"},
+		},
+	}
+
+	for _, request := range requests {
+		if _, err := client.Image(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(srv.RequestsTo("v3/image")); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+	if _, err := client.Image(mathpix.SkipCache(ctx), requests[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.RequestsTo("v3/image")); n != 2 {
+		t.Errorf("sent %d requests, want SkipCache to send one", n)
+	}
+}
+
+func TestImageCachePartial(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("v3/image", mathpixtest.Response{
+		Body: `{"text":"x","error":"image too small"}`,
+	})
+	client := srv.Client(mathpix.WithCache(mathpix.NewMemoryCache(0), 0))
+	request := &mathpix.ImageRequest{SourceURL: "https://example.com/eq.png"}
+
+	if _, err := client.Image(context.Background(), request); !mathpix.IsPartial(err) {
+		t.Fatalf("got error %v, want a partial response", err)
+	}
+	if _, err := client.Image(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.RequestsTo("v3/image")); n != 2 {
+		t.Errorf("sent %d requests, want the partial response not cached", n)
+	}
+}
@@ -0,0 +1,104 @@
+package mathpix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxCallbackBody is the largest callback body accepted by a
+// BatchCallbackHandler.
+const maxCallbackBody = 64 << 20
+
+type (
+	// Callback asks Mathpix to post the results of a batch to a URL once
+	// all of its images are processed.
+	//
+	// Delivery is not guaranteed, so callbacks should be combined with
+	// polling (see WaitForBatch).
+	Callback struct {
+		// Post is the http or https URL the results are posted to.
+		Post string `json:"post"`
+		// Reply is sent back as is in the body of the callback.
+		Reply map[string]any `json:"reply,omitempty"`
+		// Headers are added to the callback request, e.g. to authenticate
+		// it.
+		Headers map[string]string `json:"headers,omitempty"`
+	}
+	// BatchCallback is the body of the request Mathpix sends to the post
+	// URL of a batch Callback.
+	BatchCallback struct {
+		// Reply is the Reply of the Callback.
+		Reply map[string]any `json:"reply,omitempty"`
+		// Results maps the keys of the batch URLs to their result.
+		Results map[string]*ImageResponse `json:"result"`
+	}
+	// BatchCallbackHandler is an http.Handler receiving batch callbacks.
+	//
+	// The decoded callback is passed to the function. Requests are answered
+	// with 200 if it returns nil and with 500 otherwise, so that the error
+	// is visible to Mathpix.
+	BatchCallbackHandler func(ctx context.Context, cb *BatchCallback) error
+)
+
+// Validate checks the callback for the errors Mathpix reports as
+// opts_bad_callback.
+//
+// The returned error matches ErrOptsBadCallback with errors.Is.
+func (c *Callback) Validate() error {
+	u, err := url.Parse(c.Post)
+	switch {
+	case c.Post == "":
+		return badCallback("missing post url")
+	case err != nil:
+		return badCallback(err.Error())
+	case u.Scheme != "http" && u.Scheme != "https":
+		return badCallback(fmt.Sprintf("post url %q is not http(s)", c.Post))
+	case u.Host == "":
+		return badCallback(fmt.Sprintf("post url %q has no host", c.Post))
+	}
+	for name, value := range c.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return badCallback(fmt.Sprintf("invalid header name %q", name))
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return badCallback(fmt.Sprintf("invalid value of header %q", name))
+		}
+	}
+	if _, err = json.Marshal(c.Reply); err != nil {
+		return badCallback("reply: " + err.Error())
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h BatchCallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var cb BatchCallback
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBody))
+	if err == nil {
+		err = json.Unmarshal(body, &cb)
+	}
+	if err != nil {
+		http.Error(w, "invalid callback body", http.StatusBadRequest)
+		return
+	}
+	if err = h(r.Context(), &cb); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// badCallback returns an opts_bad_callback error with the given message.
+func badCallback(msg string) error {
+	return &APIError{ID: ErrOptsBadCallback, Message: &msg}
+}
@@ -0,0 +1,122 @@
+package mathpix_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestCallbackValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		callback mathpix.Callback
+		valid    bool
+	}{
+		{"valid", mathpix.Callback{
+			Post:    "https://example.com/hook",
+			Headers: map[string]string{"X-Secret": "s3cret"},
+			Reply:   map[string]any{"job": 1},
+		}, true},
+		{"missing url", mathpix.Callback{}, false},
+		{"bad scheme", mathpix.Callback{Post: "ftp://example.com/hook"}, false},
+		{"relative url", mathpix.Callback{Post: "/hook"}, false},
+		{"missing host", mathpix.Callback{Post: "https:///hook"}, false},
+		{"header name injection", mathpix.Callback{
+			Post:    "https://example.com/hook",
+			Headers: map[string]string{"X-A\r\nX-B": "v"},
+		}, false},
+		{"header value injection", mathpix.Callback{
+			Post:    "https://example.com/hook",
+			Headers: map[string]string{"X-A": "v\r\nX-B: w"},
+		}, false},
+		{"empty header name", mathpix.Callback{
+			Post:    "https://example.com/hook",
+			Headers: map[string]string{"": "v"},
+		}, false},
+		{"unencodable reply", mathpix.Callback{
+			Post:  "https://example.com/hook",
+			Reply: map[string]any{"f": func() {}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.callback.Validate()
+			if tt.valid {
+				if err != nil {
+					t.Errorf("got error %v for a valid callback", err)
+				}
+				return
+			}
+			if !errors.Is(err, mathpix.ErrOptsBadCallback) {
+				t.Errorf("got error %v, want %v", err, mathpix.ErrOptsBadCallback)
+			}
+		})
+	}
+}
+
+func TestBatchInvalidCallback(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+
+	_, err := srv.Client().Batch(context.Background(), &mathpix.RequestPostBatch{
+		URLs:     map[string]string{"a": "https://example.com/a.png"},
+		Callback: &mathpix.Callback{Post: "ftp://example.com/hook"},
+	})
+	if !errors.Is(err, mathpix.ErrOptsBadCallback) {
+		t.Fatalf("got error %v, want %v", err, mathpix.ErrOptsBadCallback)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("sent %d requests, want 0", n)
+	}
+}
+
+func TestBatchCallbackHandler(t *testing.T) {
+	const body = `{"reply":{"job":"1"},"result":{"a":{"text":"x"}}}`
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		err    error
+		want   int
+	}{
+		{"delivered", http.MethodPost, body, nil, http.StatusOK},
+		{"wrong method", http.MethodGet, "", nil, http.StatusMethodNotAllowed},
+		{"bad body", http.MethodPost, `{"result":`, nil, http.StatusBadRequest},
+		{"handler error", http.MethodPost, body, errors.New("busy"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *mathpix.BatchCallback
+			h := mathpix.BatchCallbackHandler(
+				func(_ context.Context, cb *mathpix.BatchCallback) error {
+					got = cb
+					return tt.err
+				},
+			)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(
+				tt.method,
+				"/hook",
+				strings.NewReader(tt.body),
+			))
+
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusMethodNotAllowed &&
+				rec.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("got Allow %q, want POST", rec.Header().Get("Allow"))
+			}
+			if tt.want == http.StatusOK &&
+				(got.Reply["job"] != "1" || got.Results["a"].Text != "x") {
+				t.Errorf("got callback %+v", got)
+			}
+		})
+	}
+}
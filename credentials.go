@@ -0,0 +1,190 @@
+package mathpix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvAppID is the environment variable read by EnvCredentials for the
+	// app id.
+	EnvAppID = "MATHPIX_APP_ID"
+	// EnvAppKey is the environment variable read by EnvCredentials for the
+	// app key.
+	EnvAppKey = "MATHPIX_APP_KEY"
+)
+
+type (
+	// Credentials authenticate requests to the Mathpix API.
+	//
+	// If AppToken is set, it is used instead of AppID and AppKey.
+	Credentials struct {
+		// AppID is the Mathpix app id.
+		AppID string `json:"app_id"`
+		// AppKey is the Mathpix app key.
+		AppKey string `json:"app_key"`
+		// AppToken is a temporary app token.
+		AppToken string `json:"app_token,omitempty"`
+	}
+	// CredentialsProvider provides the credentials used for every request
+	// the Client sends.
+	CredentialsProvider interface {
+		// Credentials returns the current credentials.
+		Credentials(ctx context.Context) (Credentials, error)
+	}
+	// StaticCredentials is a CredentialsProvider that always returns the
+	// same credentials.
+	StaticCredentials Credentials
+	// EnvCredentials is a CredentialsProvider that reads the credentials
+	// from the MATHPIX_APP_ID and MATHPIX_APP_KEY environment variables.
+	EnvCredentials struct{}
+	// FileCredentials is a CredentialsProvider that reads the credentials
+	// from a JSON file with app_id and app_key fields.
+	//
+	// The file is read on every call and parsed again whenever its content
+	// changes, so keys can be rotated without rebuilding the Client. Wrap
+	// it in a CachedCredentials to read it less often. It is safe for
+	// concurrent use.
+	FileCredentials struct {
+		path    string
+		mu      sync.Mutex
+		content []byte
+		current Credentials
+	}
+	// CachedCredentials is a CredentialsProvider that caches the
+	// credentials of another provider for a fixed duration.
+	//
+	// It is safe for concurrent use.
+	CachedCredentials struct {
+		provider CredentialsProvider
+		ttl      time.Duration
+		mu       sync.Mutex
+		expires  time.Time
+		current  Credentials
+	}
+)
+
+// WithCredentials sets the provider of the credentials used for every
+// request, replacing the app key and app id given to NewClient.
+func WithCredentials(provider CredentialsProvider) ClientOption {
+	return func(c *Client) { c.credentials = provider }
+}
+
+// String returns the credentials with the secrets redacted.
+func (c Credentials) String() string {
+	return "{AppID:" + c.AppID +
+		" AppKey:" + redact(c.AppKey) +
+		" AppToken:" + redact(c.AppToken) + "}"
+}
+
+// LogValue implements slog.LogValuer, redacting the secrets.
+func (c Credentials) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("app_id", c.AppID),
+		slog.String("app_key", redact(c.AppKey)),
+		slog.String("app_token", redact(c.AppToken)),
+	)
+}
+
+// setHeaders sets the authentication headers of req.
+func (c Credentials) setHeaders(req *http.Request) {
+	if c.AppToken != "" {
+		req.Header.Set("app_token", c.AppToken)
+		return
+	}
+	req.Header.Set("app_key", c.AppKey)
+	req.Header.Set("app_id", c.AppID)
+}
+
+// Credentials returns the static credentials.
+func (s StaticCredentials) Credentials(context.Context) (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// Credentials returns the credentials from the environment.
+func (EnvCredentials) Credentials(context.Context) (Credentials, error) {
+	creds := Credentials{
+		AppID:  os.Getenv(EnvAppID),
+		AppKey: os.Getenv(EnvAppKey),
+	}
+	if creds.AppID == "" || creds.AppKey == "" {
+		return creds, errors.New(
+			"mathpix: " + EnvAppID + " and " + EnvAppKey + " must be set",
+		)
+	}
+	return creds, nil
+}
+
+// NewFileCredentials creates a new FileCredentials reading the file at
+// path.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+// Credentials returns the credentials from the file, parsing it again if
+// its content changed since the last call.
+//
+// The content is compared rather than the modification time, which can
+// miss a rotation of a key of the same length within its resolution.
+func (f *FileCredentials) Credentials(context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if f.content != nil && bytes.Equal(b, f.content) {
+		return f.current, nil
+	}
+	var creds Credentials
+	if err = json.Unmarshal(b, &creds); err != nil {
+		return Credentials{}, err
+	}
+	f.content, f.current = b, creds
+	return creds, nil
+}
+
+// NewCachedCredentials creates a new CachedCredentials caching the
+// credentials of provider for ttl.
+func NewCachedCredentials(
+	provider CredentialsProvider,
+	ttl time.Duration,
+) *CachedCredentials {
+	return &CachedCredentials{provider: provider, ttl: ttl}
+}
+
+// Credentials returns the cached credentials, refreshing them from the
+// underlying provider once they are older than the ttl.
+func (c *CachedCredentials) Credentials(
+	ctx context.Context,
+) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.current, nil
+	}
+	creds, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.current, c.expires = creds, time.Now().Add(c.ttl)
+	return creds, nil
+}
+
+// redact hides all but the last four characters of a secret.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "REDACTED"
+	}
+	return "REDACTED..." + secret[len(secret)-4:]
+}
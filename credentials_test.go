@@ -0,0 +1,116 @@
+package mathpix_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+// countingCredentials returns credentials with an app key numbered after
+// the number of calls.
+type countingCredentials struct{ calls int }
+
+func (c *countingCredentials) Credentials(
+	context.Context,
+) (mathpix.Credentials, error) {
+	c.calls++
+	return mathpix.Credentials{
+		AppID:  "id",
+		AppKey: fmt.Sprint("key-", c.calls),
+	}, nil
+}
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv(mathpix.EnvAppID, "id")
+	t.Setenv(mathpix.EnvAppKey, "key")
+
+	creds, err := mathpix.EnvCredentials{}.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AppID != "id" || creds.AppKey != "key" {
+		t.Errorf("got credentials %v", creds)
+	}
+
+	t.Setenv(mathpix.EnvAppKey, "")
+	if _, err = (mathpix.EnvCredentials{}).Credentials(context.Background()); err == nil {
+		t.Error("expected an error for a missing app key")
+	}
+}
+
+func TestFileCredentialsRotation(t *testing.T) {
+	path := writeFile(t, "creds.json", `{"app_id":"id","app_key":"key-1"}`)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := mathpix.NewFileCredentials(path)
+	ctx := context.Background()
+	if _, err = provider.Credentials(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key of the same length written within the resolution of the
+	// modification time.
+	if err = os.WriteFile(path, []byte(`{"app_id":"id","app_key":"key-2"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := provider.Credentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AppKey != "key-2" {
+		t.Errorf("got app key %q, want the rotated key-2", creds.AppKey)
+	}
+}
+
+func TestFileCredentialsClient(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	path := writeFile(t, "creds.json", `{"app_id":"id","app_key":"key-1"}`)
+	client := srv.Client(mathpix.WithCredentials(mathpix.NewFileCredentials(path)))
+
+	if _, err := client.Image(context.Background(), &mathpix.ImageRequest{
+		SourceURL: "https://example.com/eq.png",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := srv.RequestsTo("v3/image")
+	if got := reqs[0].Header.Get("app_key"); got != "key-1" {
+		t.Errorf("sent app key %q, want key-1", got)
+	}
+}
+
+func TestCachedCredentials(t *testing.T) {
+	ctx := context.Background()
+	provider := &countingCredentials{}
+	cached := mathpix.NewCachedCredentials(provider, 20*time.Millisecond)
+
+	for range 3 {
+		creds, err := cached.Credentials(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.AppKey != "key-1" {
+			t.Errorf("got app key %q, want the cached key-1", creds.AppKey)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	creds, err := cached.Credentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AppKey != "key-2" || provider.calls != 2 {
+		t.Errorf("got app key %q after %d calls, want key-2 after 2",
+			creds.AppKey, provider.calls)
+	}
+}
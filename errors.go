@@ -1,6 +1,19 @@
 package mathpix
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrConversionPending is returned when a conversion result is requested
+// before it is done.
+var ErrConversionPending = errors.New("mathpix: conversion is not done yet")
+
+// ErrFormatNotRequested is returned when a conversion format is awaited or
+// downloaded for a processed document it was not requested for.
+var ErrFormatNotRequested = errors.New("mathpix: conversion format was not requested")
 
 type (
 	// ErrorResponse is the error response struct.
@@ -13,17 +26,68 @@ type (
 		Message *string `json:"message,omitempty"`
 		Detail  *string `json:"detail,omitempty"`
 	}
+	// ResponseError is returned when the Mathpix API responds with an error.
+	//
+	// It wraps the underlying error, usually an *APIError, together with
+	// details about the response.
+	ResponseError struct {
+		// Endpoint is the name of the called endpoint (e.g. "v3/pdf").
+		Endpoint string
+		// StatusCode is the HTTP status code of the response.
+		StatusCode int
+		// RequestID is the request_id of the response, if any.
+		RequestID string
+		// Header holds the headers of the response, such as Retry-After.
+		Header http.Header
+		// Body is the raw response body.
+		Body []byte
+		// Err is the underlying error.
+		Err error
+	}
 )
 
 // Error implements the error interface for APIError.
+//
+// Errors carrying only a message, such as {"error": "..."} bodies, render
+// as the message alone.
 func (e *APIError) Error() string {
-	if e.Message == nil {
+	switch {
+	case e.Message == nil:
 		return e.ID.String()
+	case e.ID == "":
+		return *e.Message
 	}
 	return fmt.Sprintf(`%s: %s`, e.ID.String(), *e.Message)
 }
 
+// Is reports whether target is the ErrorID of the APIError.
+//
+// It makes errors.Is(err, ErrPDFEncrypted) work on returned errors.
+func (e *APIError) Is(target error) bool {
+	id, ok := target.(ErrorID)
+	return ok && id == e.ID
+}
+
+// Error implements the error interface for ResponseError.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf(
+		"mathpix: %s: %d %s: %v",
+		e.Endpoint,
+		e.StatusCode,
+		http.StatusText(e.StatusCode),
+		e.Err,
+	)
+}
+
+// Unwrap returns the underlying error.
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
 // ErrorID is a specific error type in the system
+//
+// ErrorID implements the error interface so that the error constants can be
+// used as sentinel errors with errors.Is.
 type ErrorID string
 
 // HTTP Error Constants
@@ -127,6 +191,174 @@ func (e ErrorID) String() string {
 	return string(e)
 }
 
+// Error implements the error interface for ErrorID.
+func (e ErrorID) Error() string {
+	return string(e)
+}
+
+// IsRetryable reports whether err is a transient failure that may succeed
+// when retried.
+func IsRetryable(err error) bool {
+	status, id := errorDetails(err)
+	return DefaultRetryable(status, id, err)
+}
+
+// IsAuth reports whether err is caused by invalid or missing credentials.
+func IsAuth(err error) bool {
+	status, id := errorDetails(err)
+	return id == ErrHTTPUnauthorized ||
+		status == http.StatusUnauthorized ||
+		status == http.StatusForbidden
+}
+
+// IsQuota reports whether err is caused by exceeding a rate limit or quota.
+func IsQuota(err error) bool {
+	status, id := errorDetails(err)
+	return id == ErrHTTPMaxRequests ||
+		status == http.StatusTooManyRequests ||
+		status == http.StatusPaymentRequired
+}
+
+// IsInputError reports whether err is caused by an invalid request or input
+// that will fail again if resent unchanged.
+func IsInputError(err error) bool {
+	_, id := errorDetails(err)
+	switch id {
+	case ErrJSONSyntax,
+		ErrImageMissing,
+		ErrImageDownload,
+		ErrImageDecode,
+		ErrImageNoContent,
+		ErrImageNotSupported,
+		ErrImageMaxSize,
+		ErrStrokesMissing,
+		ErrStrokesSyntaxError,
+		ErrStrokesNoContent,
+		ErrOptsBadCallback,
+		ErrOptsUnknownOCR,
+		ErrOptsUnknownFormat,
+		ErrOptsNumberRequired,
+		ErrOptsValueOutOfRange,
+		ErrPDFEncrypted,
+		ErrPDFUnknownID,
+		ErrPDFMissing,
+		ErrPDFPageLimitExceeded,
+		ErrMathConfidence,
+		ErrMathSyntax,
+		ErrBatchUnknownID,
+		ErrSysRequestTooLarge:
+		return true
+	default:
+		return false
+	}
+}
+
+// errorDetails extracts the HTTP status code and ErrorID from err.
+func errorDetails(err error) (int, ErrorID) {
+	var (
+		status  int
+		id      ErrorID
+		respErr *ResponseError
+		apiErr  *APIError
+	)
+	if errors.As(err, &respErr) {
+		status = respErr.StatusCode
+	}
+	switch {
+	case errors.As(err, &apiErr):
+		id = apiErr.ID
+	case errors.As(err, &id):
+	}
+	return status, id
+}
+
+// responseError returns the error carried by a response of the endpoint, or
+// nil if the response is successful.
+//
+// Error responses without a JSON body are mapped to an ErrorID based on
+// their status code. For 2xx responses carrying an error, see IsPartial.
+func responseError(endpoint string, res *http.Response, body []byte) error {
+	requestID, apiErr := ParseError(body)
+	if !failedStatus(res.StatusCode) && apiErr == nil {
+		return nil
+	}
+	respErr := &ResponseError{
+		Endpoint:   endpoint,
+		StatusCode: res.StatusCode,
+		RequestID:  requestID,
+		Header:     res.Header,
+		Body:       body,
+	}
+	switch {
+	case apiErr != nil:
+		respErr.Err = apiErr
+	case res.StatusCode == http.StatusUnauthorized:
+		respErr.Err = ErrHTTPUnauthorized
+	case res.StatusCode == http.StatusTooManyRequests:
+		respErr.Err = ErrHTTPMaxRequests
+	default:
+		respErr.Err = errors.New(res.Status)
+	}
+	return respErr
+}
+
+// ParseError extracts the request id and error from a Mathpix response body.
+//
+// It understands the shapes returned by Mathpix:
+//
+//	{"error": {"id": "...", "message": "..."}}
+//	{"error": "...", "error_info": {"id": "...", "message": "..."}}
+//	{"id": "...", "message": "..."}
+//
+// The returned error is nil if the body carries no error.
+func ParseError(body []byte) (string, *APIError) {
+	var probe struct {
+		APIError
+		RequestID string          `json:"request_id"`
+		Error     json.RawMessage `json:"error"`
+		ErrorInfo *ErrorInfo      `json:"error_info"`
+	}
+	if json.Unmarshal(body, &probe) != nil {
+		return "", nil
+	}
+	var (
+		nested ErrorResponse
+		msg    string
+	)
+	switch {
+	case json.Unmarshal(body, &nested) == nil && nested.Error.ID != "":
+		return probe.RequestID, &nested.Error
+	case probe.ErrorInfo != nil && probe.ErrorInfo.ErrorID() != "":
+		apiErr := &APIError{ID: probe.ErrorInfo.ErrorID()}
+		if probe.ErrorInfo.Message != "" {
+			apiErr.Message = &probe.ErrorInfo.Message
+		} else if json.Unmarshal(probe.Error, &msg) == nil && msg != "" {
+			apiErr.Message = &msg
+		}
+		return probe.RequestID, apiErr
+	case isErrorID(probe.ID):
+		return probe.RequestID, &probe.APIError
+	case json.Unmarshal(probe.Error, &msg) == nil && msg != "":
+		return probe.RequestID, &APIError{Message: &msg}
+	default:
+		return probe.RequestID, nil
+	}
+}
+
+// IsPartial reports whether err was returned for a successful response that
+// carries an error, such as an ImageResponse with error_info set.
+//
+// The decoded response is returned alongside such errors.
+func IsPartial(err error) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) && !failedStatus(respErr.StatusCode)
+}
+
+// failedStatus reports whether the HTTP status code is not a 2xx.
+func failedStatus(code int) bool {
+	return code < http.StatusOK || code >= http.StatusMultipleChoices
+}
+
 func isErrorID(in ErrorID) bool {
 	switch in {
 	case ErrHTTPUnauthorized,
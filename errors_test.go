@@ -0,0 +1,114 @@
+package mathpix_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		requestID string
+		id        mathpix.ErrorID
+		message   string
+	}{
+		{
+			"nested",
+			`{"request_id":"r1","error":{"id":"image_decode_error","message":"cannot decode"}}`,
+			"r1", mathpix.ErrImageDecode, "cannot decode",
+		},
+		{
+			"error info",
+			`{"request_id":"r2","error":"Cannot decode","error_info":{"id":"image_decode_error","message":"cannot decode"}}`,
+			"r2", mathpix.ErrImageDecode, "cannot decode",
+		},
+		{
+			"error info code",
+			`{"error":"Cannot decode","error_info":{"code":"image_decode_error","message":""}}`,
+			"", mathpix.ErrImageDecode, "Cannot decode",
+		},
+		{
+			"flat",
+			`{"id":"pdf_unknown_id","message":"unknown pdf"}`,
+			"", mathpix.ErrPDFUnknownID, "unknown pdf",
+		},
+		{
+			"message only",
+			`{"request_id":"r3","error":"PDF could not be processed"}`,
+			"r3", "", "PDF could not be processed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestID, apiErr := mathpix.ParseError([]byte(tt.body))
+			if apiErr == nil {
+				t.Fatal("expected an error")
+			}
+			if requestID != tt.requestID {
+				t.Errorf("got request id %q, want %q", requestID, tt.requestID)
+			}
+			if apiErr.ID != tt.id {
+				t.Errorf("got id %q, want %q", apiErr.ID, tt.id)
+			}
+			if apiErr.Message == nil || *apiErr.Message != tt.message {
+				t.Errorf("got message %v, want %q", apiErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseErrorNone(t *testing.T) {
+	for _, body := range []string{
+		`{"request_id":"r1","text":"x"}`,
+		`{"id":"not_an_error_id","message":"hello"}`,
+		`not json`,
+		``,
+	} {
+		if _, apiErr := mathpix.ParseError([]byte(body)); apiErr != nil {
+			t.Errorf("got error %v for %q", apiErr, body)
+		}
+	}
+}
+
+func TestAPIErrorMessageOnly(t *testing.T) {
+	_, apiErr := mathpix.ParseError([]byte(`{"error":"PDF could not be processed"}`))
+	if apiErr == nil {
+		t.Fatal("expected an error")
+	}
+	if got := apiErr.Error(); got != "PDF could not be processed" {
+		t.Errorf("got message %q", got)
+	}
+}
+
+func TestIsPartial(t *testing.T) {
+	partial := &mathpix.ResponseError{
+		StatusCode: http.StatusOK,
+		Err:        mathpix.ErrImageDecode,
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"successful status", partial, true},
+		{"wrapped", fmt.Errorf("image 1: %w", partial), true},
+		{"failed status", &mathpix.ResponseError{
+			StatusCode: http.StatusBadRequest,
+			Err:        mathpix.ErrImageDecode,
+		}, false},
+		{"not a response error", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mathpix.IsPartial(tt.err); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
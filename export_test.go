@@ -0,0 +1,6 @@
+package mathpix
+
+import "time"
+
+// SetClock replaces the clock of the RateLimiter.
+func (l *RateLimiter) SetClock(now func() time.Time) { l.now = now }
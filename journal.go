@@ -0,0 +1,390 @@
+package mathpix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Job kinds.
+const (
+	// JobPdf is a document submitted with Client.Pdf.
+	JobPdf JobKind = "pdf"
+	// JobBatch is a batch submitted with Client.Batch.
+	JobBatch JobKind = "batch"
+)
+
+type (
+	// JobKind is the kind of a journaled Job.
+	JobKind string
+	// Job is a submission recorded in a Journal.
+	Job struct {
+		// Key identifies the submitted input. Submitting an input with a
+		// key already in the journal returns the recorded job instead.
+		Key string `json:"key"`
+		// Kind is the kind of the job.
+		Kind JobKind `json:"kind"`
+		// ID is the PDFID or BatchID returned by Mathpix.
+		ID string `json:"id"`
+		// File is the path of the uploaded file, if any.
+		File string `json:"file,omitempty"`
+		// Input is the JSON encoded request.
+		Input json.RawMessage `json:"input,omitempty"`
+		// State is processing until the job is completed or failed.
+		State ConversionStatusType `json:"state"`
+		// Error describes why the job failed.
+		Error string `json:"error,omitempty"`
+		// UpdatedAt is the time the job was last recorded.
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	// Journal durably records submitted jobs, so that they can be resumed
+	// after a crash instead of being submitted again.
+	//
+	// Jobs are recorded once Mathpix has returned their id: an input whose
+	// submission is interrupted by a crash before that has no record and is
+	// submitted, and billed, again.
+	Journal interface {
+		// Record stores the job, replacing any job with the same key.
+		Record(ctx context.Context, job *Job) error
+		// Get returns the job with the given key and whether it was found.
+		Get(ctx context.Context, key string) (*Job, bool, error)
+		// Jobs returns every job, in the order they were first recorded.
+		Jobs(ctx context.Context) ([]*Job, error)
+	}
+	// FileJournal is a Journal appending jobs to a JSON lines file.
+	//
+	// Each line holds a snapshot of a job; the last line of a key wins. It
+	// is safe for concurrent use.
+	FileJournal struct {
+		mu    sync.Mutex
+		f     *os.File
+		jobs  map[string]*Job
+		order []string
+	}
+)
+
+// OpenFileJournal opens the journal file at path, creating it if needed.
+//
+// A last line left incomplete by a crash in the middle of a Record is
+// dropped from the file. The journal must be closed with Close when done.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &FileJournal{f: f, jobs: make(map[string]*Job)}
+	if err = j.load(path); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// load reads the jobs of the journal file and repairs its last line.
+func (j *FileJournal) load(path string) error {
+	b, err := io.ReadAll(j.f)
+	if err != nil {
+		return err
+	}
+	end := bytes.LastIndexByte(b, '\n') + 1
+	for i, line := range bytes.Split(b[:end], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var job Job
+		if err = json.Unmarshal(line, &job); err != nil {
+			return fmt.Errorf("mathpix: %s:%d: %w", path, i+1, err)
+		}
+		j.set(&job)
+	}
+	tail := b[end:]
+	if len(tail) == 0 {
+		return nil
+	}
+	// The last line is kept if only its newline is missing, and removed
+	// otherwise, so that the next record starts on a line of its own.
+	var job Job
+	if json.Unmarshal(tail, &job) == nil {
+		j.set(&job)
+		_, err = j.f.Write([]byte("\n"))
+	} else {
+		err = j.f.Truncate(int64(end))
+	}
+	if err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Record appends the job to the file and syncs it to disk.
+func (j *FileJournal) Record(_ context.Context, job *Job) error {
+	if job.Key == "" {
+		return errors.New("mathpix: journaled job has no key")
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err = j.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err = j.f.Sync(); err != nil {
+		return err
+	}
+	copied := *job
+	j.set(&copied)
+	return nil
+}
+
+// Get returns the job with the given key.
+func (j *FileJournal) Get(_ context.Context, key string) (*Job, bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[key]
+	if !ok {
+		return nil, false, nil
+	}
+	copied := *job
+	return &copied, true, nil
+}
+
+// Jobs returns every job, in the order they were first recorded.
+func (j *FileJournal) Jobs(context.Context) ([]*Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]*Job, 0, len(j.order))
+	for _, key := range j.order {
+		copied := *j.jobs[key]
+		jobs = append(jobs, &copied)
+	}
+	return jobs, nil
+}
+
+// Close closes the journal file.
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// set indexes the job.
+//
+// j.mu must be held, if needed.
+func (j *FileJournal) set(job *Job) {
+	if _, ok := j.jobs[job.Key]; !ok {
+		j.order = append(j.order, job.Key)
+	}
+	j.jobs[job.Key] = job
+}
+
+// SubmitPdf submits a document with Pdf and records it in the journal
+// under key.
+//
+// If the journal already holds a job with the key, it is returned and the
+// document is not submitted again.
+func (c *Client) SubmitPdf(
+	ctx context.Context,
+	journal Journal,
+	key string,
+	request *RequestDocument,
+) (*Job, error) {
+	return submit(ctx, journal, key, JobPdf, request.File, request,
+		func() (string, error) {
+			res, err := c.Pdf(ctx, request)
+			if err != nil {
+				return "", err
+			}
+			return res.PDFID, nil
+		},
+	)
+}
+
+// SubmitBatch submits a batch with Batch and records it in the journal
+// under key.
+//
+// If the journal already holds a job with the key, it is returned and the
+// batch is not submitted again.
+func (c *Client) SubmitBatch(
+	ctx context.Context,
+	journal Journal,
+	key string,
+	request *RequestPostBatch,
+) (*Job, error) {
+	return submit(ctx, journal, key, JobBatch, "", request,
+		func() (string, error) {
+			res, err := c.Batch(ctx, request)
+			if err != nil {
+				return "", err
+			}
+			return res.BatchID, nil
+		},
+	)
+}
+
+// Resume re-attaches to the jobs of the journal that are still processing.
+//
+// The status of every processing job is polled once with PdfResult or
+// GetBatch and recorded if it changed. Jobs whose id is unknown to Mathpix
+// are recorded as failed. It returns the jobs that are still processing,
+// which can be awaited with WaitForJob.
+func (c *Client) Resume(ctx context.Context, journal Journal) ([]*Job, error) {
+	jobs, err := journal.Jobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var processing []*Job
+	for _, job := range jobs {
+		if job.State != ConversionStatusProcessing {
+			continue
+		}
+		if err = c.refreshJob(ctx, job); err != nil {
+			return processing, err
+		}
+		if job.State != ConversionStatusProcessing {
+			if err = record(ctx, journal, job); err != nil {
+				return processing, err
+			}
+			continue
+		}
+		processing = append(processing, job)
+	}
+	return processing, nil
+}
+
+// WaitForJob waits until the job is done with WaitForPdf or WaitForBatch
+// and records its final state in the journal.
+//
+// Jobs that are already done are returned immediately. Failed jobs are
+// recorded with their error.
+func (c *Client) WaitForJob(
+	ctx context.Context,
+	journal Journal,
+	job *Job,
+) error {
+	if job.State != ConversionStatusProcessing {
+		return nil
+	}
+	var err error
+	switch job.Kind {
+	case JobPdf:
+		_, err = c.WaitForPdf(ctx, job.ID, nil)
+	case JobBatch:
+		_, err = c.WaitForBatch(ctx, job.ID, batchKeys(job)...)
+	default:
+		return fmt.Errorf("mathpix: unknown job kind %q", job.Kind)
+	}
+	var convErr *ConversionError
+	switch {
+	case err == nil:
+		job.State = ConversionStatusCompleted
+	case errors.As(err, &convErr):
+		job.State, job.Error = ConversionStatusError, err.Error()
+	default:
+		if err = failJob(job, err); err != nil {
+			return err
+		}
+	}
+	return record(ctx, journal, job)
+}
+
+// refreshJob polls the status of the job once and updates its state.
+func (c *Client) refreshJob(ctx context.Context, job *Job) error {
+	switch job.Kind {
+	case JobPdf:
+		result, err := c.PdfResult(ctx, &ResultRequest{PDFID: job.ID})
+		if err != nil && !IsPartial(err) {
+			return failJob(job, err)
+		}
+		var formats []DocumentOutputFormat
+		for format := range result.Coversions {
+			formats = append(formats, format)
+		}
+		done, err := conversionDone(job.ID, result, formats, err)
+		switch {
+		case err != nil:
+			job.State, job.Error = ConversionStatusError, err.Error()
+		case done:
+			job.State = ConversionStatusCompleted
+		}
+	case JobBatch:
+		result, err := c.GetBatch(ctx, job.ID)
+		if err != nil {
+			return failJob(job, err)
+		}
+		if batchDone(result, batchKeys(job)) {
+			job.State = ConversionStatusCompleted
+		}
+	default:
+		return fmt.Errorf("mathpix: unknown job kind %q", job.Kind)
+	}
+	return nil
+}
+
+// batchKeys returns the keys of the URLs of the journaled batch request.
+func batchKeys(job *Job) []string {
+	var request RequestPostBatch
+	if json.Unmarshal(job.Input, &request) != nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(request.URLs))
+}
+
+// failJob marks the job as failed if err is an input error, such as an
+// expired id, and returns other errors.
+func failJob(job *Job, err error) error {
+	if !IsInputError(err) {
+		return err
+	}
+	job.State, job.Error = ConversionStatusError, err.Error()
+	return nil
+}
+
+// submit returns the job recorded under key, or calls send and records the
+// job it submitted.
+func submit(
+	ctx context.Context,
+	journal Journal,
+	key string,
+	kind JobKind,
+	file string,
+	request any,
+	send func() (string, error),
+) (*Job, error) {
+	job, ok, err := journal.Get(ctx, key)
+	if err != nil || ok {
+		return job, err
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	id, err := send()
+	if err != nil {
+		return nil, err
+	}
+	job = &Job{
+		Key:   key,
+		Kind:  kind,
+		ID:    id,
+		File:  file,
+		Input: input,
+		State: ConversionStatusProcessing,
+	}
+	return job, record(ctx, journal, job)
+}
+
+// record stamps the job and records it in the journal.
+func record(ctx context.Context, journal Journal, job *Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	return journal.Record(ctx, job)
+}
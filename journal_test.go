@@ -0,0 +1,152 @@
+package mathpix_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+// openJournal opens the journal at path, closing it when the test ends.
+func openJournal(t *testing.T, path string) *mathpix.FileJournal {
+	t.Helper()
+	j, err := mathpix.OpenFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+// jobKeys returns the keys and states of the jobs of the journal.
+func jobKeys(t *testing.T, j mathpix.Journal) map[string]mathpix.ConversionStatusType {
+	t.Helper()
+	jobs, err := j.Jobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]mathpix.ConversionStatusType, len(jobs))
+	for _, job := range jobs {
+		keys[job.Key] = job.State
+	}
+	return keys
+}
+
+func TestFileJournalReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	j := openJournal(t, path)
+	for _, job := range []*mathpix.Job{
+		{Key: "a", Kind: mathpix.JobPdf, ID: "1", State: mathpix.ConversionStatusProcessing},
+		{Key: "b", Kind: mathpix.JobPdf, ID: "2", State: mathpix.ConversionStatusProcessing},
+		{Key: "a", Kind: mathpix.JobPdf, ID: "1", State: mathpix.ConversionStatusCompleted},
+	} {
+		if err := j.Record(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	keys := jobKeys(t, openJournal(t, path))
+	if len(keys) != 2 ||
+		keys["a"] != mathpix.ConversionStatusCompleted ||
+		keys["b"] != mathpix.ConversionStatusProcessing {
+		t.Errorf("got jobs %v", keys)
+	}
+}
+
+func TestFileJournalTornLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	j := openJournal(t, path)
+	if err := j.Record(ctx, &mathpix.Job{Key: "a", ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	appendFile(t, path, `{"key":"b","ki`)
+
+	j = openJournal(t, path)
+	if keys := jobKeys(t, j); len(keys) != 1 {
+		t.Fatalf("got jobs %v, want only a", keys)
+	}
+	if err := j.Record(ctx, &mathpix.Job{Key: "c", ID: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	keys := jobKeys(t, openJournal(t, path))
+	if _, ok := keys["c"]; len(keys) != 2 || !ok {
+		t.Errorf("got jobs %v, want a and c", keys)
+	}
+}
+
+func TestFileJournalMissingNewline(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	appendFile(t, path, `{"key":"a","id":"1"}`)
+
+	j := openJournal(t, path)
+	if err := j.Record(ctx, &mathpix.Job{Key: "b", ID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	if keys := jobKeys(t, openJournal(t, path)); len(keys) != 2 {
+		t.Errorf("got jobs %v, want a and b", keys)
+	}
+}
+
+func TestSubmitPdfResume(t *testing.T) {
+	ctx := context.Background()
+	srv := mathpixtest.NewServer(mathpixtest.WithDocument(mathpixtest.Document{
+		Pages: []string{"# Title"},
+		Polls: 1,
+	}))
+	defer srv.Close()
+	client := srv.Client()
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	request := &mathpix.RequestDocument{URL: "https://example.com/paper.pdf"}
+
+	j := openJournal(t, path)
+	for range 2 {
+		if _, err := client.SubmitPdf(ctx, j, "paper", request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(srv.RequestsTo("POST v3/pdf")); n != 1 {
+		t.Fatalf("submitted %d times, want 1", n)
+	}
+	j.Close()
+
+	// The first poll reports the document as processing.
+	j = openJournal(t, path)
+	processing, err := client.Resume(ctx, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processing) != 1 {
+		t.Fatalf("got %d processing jobs, want 1", len(processing))
+	}
+	if err = client.WaitForJob(ctx, j, processing[0]); err != nil {
+		t.Fatal(err)
+	}
+	if keys := jobKeys(t, j); keys["paper"] != mathpix.ConversionStatusCompleted {
+		t.Errorf("got jobs %v, want paper completed", keys)
+	}
+}
+
+// appendFile appends data to the file at path.
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+package mathpix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+)
+
+type (
+	// PdfLinesResponse is the lines JSON of a processed document.
+	PdfLinesResponse struct {
+		// Pages contains the line data of every page.
+		Pages []PdfPage `json:"pages"`
+	}
+	// PdfPage represents the line data of a single document page.
+	PdfPage struct {
+		// ImageID is the id of the page image
+		ImageID string `json:"image_id"`
+		// Page is the 1-based page number
+		Page int `json:"page"`
+		// PageWidth is the width of the page image in pixels
+		PageWidth int `json:"page_width"`
+		// PageHeight is the height of the page image in pixels
+		PageHeight int `json:"page_height"`
+		// Lines contains the lines detected on the page
+		Lines []PdfLine `json:"lines"`
+	}
+	// PdfLine represents a line detected on a document page.
+	// It mirrors LineData for images, with the addition of a bounding region.
+	PdfLine struct {
+		// ID uniquely identifies the line within the document
+		ID string `json:"id,omitempty"`
+		// ParentID is the id of the line containing this line
+		ParentID string `json:"parent_id,omitempty"`
+		// ChildrenIDs are the ids of the lines contained in this line
+		ChildrenIDs []string `json:"children_ids,omitempty"`
+		// Type specifies the content type of the line (e.g. "text", "math", "table")
+		Type string `json:"type"`
+		// Subtype provides additional type information for specific content types
+		Subtype string `json:"subtype,omitempty"`
+		// Line is the 1-based line number on the page
+		Line int `json:"line"`
+		// Column is the 0-based column the line belongs to
+		Column int `json:"column"`
+		// Region is the bounding box of the line
+		Region Region `json:"region"`
+		// Cnt represents the contour of the line as a list of [x,y] pixel coordinates
+		Cnt [][2]int `json:"cnt"`
+		// Text contains the recognized content in Mathpix Markdown format
+		Text string `json:"text"`
+		// FontSize is the estimated font size of the line
+		FontSize float64 `json:"font_size,omitempty"`
+		// IsPrinted indicates whether the line contains printed text
+		IsPrinted bool `json:"is_printed"`
+		// IsHandwritten indicates whether the line contains handwritten text
+		IsHandwritten bool `json:"is_handwritten"`
+		// ConversionOutput indicates whether the line is part of the converted output
+		ConversionOutput bool `json:"conversion_output"`
+		// Confidence represents the estimated probability (0-1) that recognition is 100% correct
+		Confidence float64 `json:"confidence,omitempty"`
+		// ConfidenceRate represents the estimated confidence (0-1) of output quality
+		ConfidenceRate float64 `json:"confidence_rate,omitempty"`
+	}
+	// Region represents a rectangular area of a page in pixel coordinates.
+	Region struct {
+		// TopLeftX is the x coordinate of the top left corner
+		TopLeftX int `json:"top_left_x"`
+		// TopLeftY is the y coordinate of the top left corner
+		TopLeftY int `json:"top_left_y"`
+		// Width is the width of the region
+		Width int `json:"width"`
+		// Height is the height of the region
+		Height int `json:"height"`
+	}
+)
+
+// PdfLines fetches the lines JSON of a processed document.
+//
+// For large documents, PdfPages avoids decoding every page at once.
+func (c *Client) PdfLines(
+	ctx context.Context,
+	pdfID string,
+) (*PdfLinesResponse, error) {
+	var lines PdfLinesResponse
+	for page, err := range c.PdfPages(ctx, pdfID) {
+		if err != nil {
+			return nil, err
+		}
+		lines.Pages = append(lines.Pages, *page)
+	}
+	return &lines, nil
+}
+
+// PdfPages returns an iterator over the pages of the lines JSON of a
+// processed document.
+//
+// Pages are decoded one at a time while the response is read. Iteration
+// stops after the first error.
+func (c *Client) PdfPages(
+	ctx context.Context,
+	pdfID string,
+) iter.Seq2[*PdfPage, error] {
+	return func(yield func(*PdfPage, error) bool) {
+		res, err := open(
+			ctx,
+			c,
+			http.MethodGet,
+			documentsEndpoint.name,
+			pdfID+".lines.json",
+			nil,
+		)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer res.Body.Close()
+		for page, err := range decodePages(res.Body) {
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// decodePages decodes the pages array of a lines JSON document one page at
+// a time.
+func decodePages(r io.Reader) iter.Seq2[*PdfPage, error] {
+	return func(yield func(*PdfPage, error) bool) {
+		dec := json.NewDecoder(r)
+		if err := expectDelim(dec, '{'); err != nil {
+			yield(nil, err)
+			return
+		}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if key != "pages" {
+				var skip json.RawMessage
+				if err = dec.Decode(&skip); err != nil {
+					yield(nil, err)
+					return
+				}
+				continue
+			}
+			if err = expectDelim(dec, '['); err != nil {
+				yield(nil, err)
+				return
+			}
+			for dec.More() {
+				var page PdfPage
+				if err = dec.Decode(&page); err != nil {
+					yield(nil, err)
+					return
+				}
+				if !yield(&page, nil) {
+					return
+				}
+			}
+			if err = expectDelim(dec, ']'); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// expectDelim reads the next token and checks that it is the given
+// delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("mathpix: expected %q, got %v", delim, tok)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package mathpix_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestPdfLines(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	pages := []string{"# One", "# Two", "# Three"}
+	srv.AddDocument("doc", mathpixtest.Document{Pages: pages})
+	client := srv.Client()
+	if _, err := client.WaitForPdf(context.Background(), "doc", fastWait); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := client.PdfLines(context.Background(), "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines.Pages) != len(pages) {
+		t.Fatalf("got %d pages, want %d", len(lines.Pages), len(pages))
+	}
+	for i, page := range lines.Pages {
+		if page.Page != i+1 || len(page.Lines) != 1 || page.Lines[0].Text != pages[i] {
+			t.Errorf("got page %d %+v, want %q", i+1, page, pages[i])
+		}
+	}
+}
+
+func TestPdfPagesUnknownKeys(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("GET v3/pdf", mathpixtest.Response{Body: `{
+		"pdf_id": "doc",
+		"meta": {"pages": [{"page": 9}], "nested": [[1, 2], {"a": null}]},
+		"pages": [{"page": 1, "lines": []}, {"page": 2, "lines": []}],
+		"version": 2
+	}`})
+
+	var got []int
+	for page, err := range srv.Client().PdfPages(context.Background(), "doc") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page.Page)
+	}
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Errorf("got pages %v, want [1 2]", got)
+	}
+}
+
+func TestPdfPagesMalformed(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("GET v3/pdf", mathpixtest.Response{
+		Body: `{"pages": [{"page": 1}, {"page": `,
+	})
+
+	var pages int
+	var err error
+	for _, err = range srv.Client().PdfPages(context.Background(), "doc") {
+		if err != nil {
+			break
+		}
+		pages++
+	}
+	if err == nil || pages != 1 {
+		t.Errorf("got %d pages and error %v, want 1 page then an error", pages, err)
+	}
+}
+
+func TestPdfPagesStreamed(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	closed := make(chan struct{})
+	// The first page is sent and the response is held open until the
+	// client goes away.
+	srv.Handle("GET v3/pdf", http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			page, _ := json.Marshal(mathpix.PdfPage{Page: 1})
+			fmt.Fprintf(w, `{"pdf_id":"doc","pages":[%s,`, page)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			close(closed)
+		},
+	))
+
+	for page, err := range srv.Client().PdfPages(context.Background(), "doc") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Page != 1 {
+			t.Errorf("got page %d, want 1", page.Page)
+		}
+		break
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("response not closed after stopping the iteration")
+	}
+}
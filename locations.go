@@ -1,8 +1,11 @@
 package mathpix
 
 import (
+	"io"
 	"net/http"
+	"path/filepath"
 	"slices"
+	"strings"
 	"time"
 )
 
@@ -21,10 +24,30 @@ var (
 		method: http.MethodPost,
 		name:   "v3/image",
 	}
+	imageUploadEndpoint = endpoint[*uploadPayload, *ImageResponse]{
+		method: http.MethodPost,
+		name:   "v3/image",
+	}
+	textEndpoint = endpoint[*textRequestPayload, *ImageResponse]{
+		method: http.MethodPost,
+		name:   "v3/text",
+	}
+	textUploadEndpoint = endpoint[*uploadPayload, *ImageResponse]{
+		method: http.MethodPost,
+		name:   "v3/text",
+	}
+	latexEndpoint = endpoint[*latexRequestPayload, *LatexResponse]{
+		method: http.MethodPost,
+		name:   "v3/latex",
+	}
 	documentsEndpoint = endpoint[*documentRequestPayload, *DocumentResponse]{
 		method: http.MethodPost,
 		name:   "v3/pdf",
 	}
+	documentUploadEndpoint = endpoint[*uploadPayload, *DocumentResponse]{
+		method: http.MethodPost,
+		name:   "v3/pdf",
+	}
 	conversionStatusEndpoint = endpoint[*resultRequestPayload, *ConversionResultResponse]{
 		method: http.MethodGet,
 		name:   "v3/status",
@@ -60,6 +83,17 @@ type (
 	imageRequestPayload struct {
 		Payload *ImageRequest `in:"body=json"`
 	}
+	uploadPayload struct {
+		File    *Upload
+		Options string
+		request any
+	}
+	textRequestPayload struct {
+		Payload *TextRequest `in:"body=json"`
+	}
+	latexRequestPayload struct {
+		Payload *LatexRequest `in:"body=json"`
+	}
 	postBatchRequestPayload struct {
 		Payload *RequestPostBatch `in:"body=json"`
 	}
@@ -100,10 +134,13 @@ type (
 		// Optional.
 		SourceURL string `json:"src,omitempty" in:"form=src"`
 		// File is a optional filepath for the image data.
-		// If specified, SourceURL will be ignored.
-		File string `json:"file,omitempty" in:"form=file"`
+		// If specified, the file is uploaded and SourceURL will be ignored.
+		File string `json:"-"`
+		// Reader is an optional stream of image data.
+		// If specified, the data is uploaded and File and SourceURL will be ignored.
+		Reader io.Reader `json:"-"`
 
-		Options *RequestDocument `json:"options_json" in:"form=options_json"`
+		Options *RequestDocument `json:"options_json,omitempty" in:"form=options_json"`
 		// Metadata si a map of key value pairs that will be added to the image metadata.
 		// Optional.
 		Metadata map[string]string `json:"metadata,omitempty" in:"form=metadata"`
@@ -111,6 +148,102 @@ type (
 		// Optional.
 		Tags []string `json:"tags,omitempty"`
 	}
+	// TextRequest represents the request body for the v3/text endpoint.
+	//
+	// The response is decoded into an ImageResponse.
+	TextRequest struct {
+		// SourceURL is the URL or data URL of the image to be processed.
+		SourceURL string `json:"src,omitempty"`
+		// File is an optional filepath for the image data.
+		// If specified, the file is uploaded and SourceURL will be ignored.
+		File string `json:"-"`
+		// Reader is an optional stream of image data.
+		// If specified, the data is uploaded and File and SourceURL will be ignored.
+		Reader io.Reader `json:"-"`
+		// Metadata is a map of key value pairs that will be added to the image metadata.
+		Metadata map[string]any `json:"metadata,omitempty"`
+		// Tags are a list of tags that will be added to the image metadata.
+		Tags []string `json:"tags,omitempty"`
+		// Formats lists the formats to return (text, data, html, latex_styled).
+		// Defaults to text.
+		Formats []ResponseFormat `json:"formats,omitempty"`
+		// DataOptions configures the outputs of the data and html formats.
+		DataOptions *DataOptions `json:"data_options,omitempty"`
+		// IncludeDetectedAlphabets returns the detected alphabets.
+		IncludeDetectedAlphabets bool `json:"include_detected_alphabets,omitempty"`
+		// AlphabetsAllowed maps alphabet codes (e.g. "hi", "ru") to whether
+		// they are allowed in the output. Omitted alphabets are allowed.
+		AlphabetsAllowed map[string]bool `json:"alphabets_allowed,omitempty"`
+		// Region crops the image to the given area before processing.
+		Region *Region `json:"region,omitempty"`
+		// EnableBlueHSVFilter enables a filter removing blue hue text.
+		EnableBlueHSVFilter bool `json:"enable_blue_hsv_filter,omitempty"`
+		// ConfidenceThreshold is the minimum confidence (0-1) for the result.
+		ConfidenceThreshold *float64 `json:"confidence_threshold,omitempty"`
+		// ConfidenceRateThreshold is the minimum confidence rate (0-1) for the result.
+		ConfidenceRateThreshold *float64 `json:"confidence_rate_threshold,omitempty"`
+		// AutoRotateConfidenceThreshold is the confidence (0-1) above which the image is rotated.
+		// Set to 1 to disable rotation.
+		AutoRotateConfidenceThreshold *float64 `json:"auto_rotate_confidence_threshold,omitempty"`
+		// IncludeLineData returns LineData in the response.
+		IncludeLineData bool `json:"include_line_data,omitempty"`
+		// IncludeWordData returns WordData in the response.
+		IncludeWordData bool `json:"include_word_data,omitempty"`
+		// IncludeGeometryData returns GeometryData in the response.
+		IncludeGeometryData bool `json:"include_geometry_data,omitempty"`
+		// IncludeSmiles enables experimental chemistry diagram OCR
+		IncludeSmiles bool `json:"include_smiles,omitempty"`
+		// RemoveSpaces determines whether extra white space is removed from equations
+		RemoveSpaces *bool `json:"rm_spaces,omitempty"`
+		// RemoveFonts determines whether font commands are removed from equations
+		RemoveFonts *bool `json:"rm_fonts,omitempty"`
+		// IdiomaticEqnArrays specifies whether to use aligned, gathered, or cases instead of array environment
+		IdiomaticEqnArrays bool `json:"idiomatic_eqn_arrays,omitempty"`
+		// NumbersDefaultToMath specifies whether numbers are always math
+		NumbersDefaultToMath bool `json:"numbers_default_to_math,omitempty"`
+		// MathInlineDelimiters specifies begin/end inline math delimiters
+		MathInlineDelimiters []string `json:"math_inline_delimiters,omitempty"`
+		// MathDisplayDelimiters specifies begin/end display math delimiters
+		MathDisplayDelimiters []string `json:"math_display_delimiters,omitempty"`
+	}
+	// LatexRequest represents the request body for the legacy v3/latex endpoint.
+	LatexRequest struct {
+		// SourceURL is the URL or data URL of the image to be processed.
+		SourceURL string `json:"src"`
+		// Metadata is a map of key value pairs that will be added to the image metadata.
+		Metadata map[string]any `json:"metadata,omitempty"`
+		// Tags are a list of tags that will be added to the image metadata.
+		Tags []string `json:"tags,omitempty"`
+		// Formats lists the formats to return.
+		Formats []LatexFormat `json:"formats,omitempty"`
+		// FormatOptions configures each of the requested formats.
+		FormatOptions map[LatexFormat]*LatexFormatOptions `json:"format_options,omitempty"`
+		// OCR restricts recognition to "math" or "math" and "text".
+		OCR []string `json:"ocr,omitempty"`
+		// Region crops the image to the given area before processing.
+		Region *Region `json:"region,omitempty"`
+		// ConfidenceThreshold is the minimum confidence (0-1) for the result.
+		ConfidenceThreshold *float64 `json:"confidence_threshold,omitempty"`
+		// ConfidenceRateThreshold is the minimum confidence rate (0-1) for the result.
+		ConfidenceRateThreshold *float64 `json:"confidence_rate_threshold,omitempty"`
+		// AutoRotateConfidenceThreshold is the confidence (0-1) above which the image is rotated.
+		AutoRotateConfidenceThreshold *float64 `json:"auto_rotate_confidence_threshold,omitempty"`
+		// IncludeDetectedAlphabets returns the detected alphabets.
+		IncludeDetectedAlphabets bool `json:"include_detected_alphabets,omitempty"`
+		// AlphabetsAllowed maps alphabet codes (e.g. "hi", "ru") to whether
+		// they are allowed in the output. Omitted alphabets are allowed.
+		AlphabetsAllowed map[string]bool `json:"alphabets_allowed,omitempty"`
+	}
+	// LatexFormatOptions configures a single v3/latex output format.
+	LatexFormatOptions struct {
+		// Transforms are applied to the output in order.
+		// Values: rm_spaces, rm_newlines, rm_fonts, rm_style_syms, rm_text, long_frac
+		Transforms []string `json:"transforms,omitempty"`
+		// MathDelims specifies begin/end inline math delimiters
+		MathDelims []string `json:"math_delims,omitempty"`
+		// DisplayMathDelims specifies begin/end display math delimiters
+		DisplayMathDelims []string `json:"displaymath_delims,omitempty"`
+	}
 	// RequestPostBatch is the request body for the POST /v3/batch endpoint.
 	//
 	// The request body may contain any /v3/latex parameters except src and must also contain a urls parameter.
@@ -119,12 +252,23 @@ type (
 	RequestPostBatch struct {
 		URLs map[string]string `json:"urls"`
 		OCR  string            `json:"ocr_behavior,omitempty"`
-		// Callback *Callback         `json:"callback,omitempty"`
+		// Callback makes Mathpix post the results to a URL once the batch
+		// is processed.
+		Callback *Callback `json:"callback,omitempty"`
 	}
 	// RequestDocument represents the request parameters for processing a PDF file or URL.
 	RequestDocument struct {
 		// URL is the HTTP URL where the file can be downloaded from
 		URL string `json:"url,omitempty"`
+		// File is an optional filepath of a local document.
+		// If specified, the file is uploaded and URL will be ignored.
+		File string `json:"-"`
+		// Reader is an optional stream of document data.
+		// If specified, the data is uploaded and File and URL will be ignored.
+		Reader io.Reader `json:"-"`
+		// Filename is the name of the document read from Reader.
+		// Its extension must be a valid InputFormat.
+		Filename string `json:"-"`
 		// Streaming enables streaming of PDF pages
 		Streaming bool `json:"streaming,omitempty"`
 		// Metadata is a key-value object for additional information
@@ -308,6 +452,49 @@ type (
 		// It changes when training data or processing methods are updated
 		Version string `json:"version"`
 	}
+	// LatexResponse represents the response from the legacy v3/latex endpoint.
+	//
+	// Only the formats requested in LatexRequest.Formats are populated.
+	LatexResponse struct {
+		// RequestID is a unique identifier for debugging purposes
+		RequestID string `json:"request_id,omitempty"`
+		// Text contains the recognized text with math delimiters
+		Text string `json:"text,omitempty"`
+		// LatexNormal contains the recognized math in LaTeX
+		LatexNormal string `json:"latex_normal,omitempty"`
+		// LatexSimplified contains the recognized math in simplified LaTeX
+		LatexSimplified string `json:"latex_simplified,omitempty"`
+		// LatexStyled contains the recognized math in styled LaTeX
+		LatexStyled string `json:"latex_styled,omitempty"`
+		// LatexList contains the recognized math split into lines
+		LatexList []string `json:"latex_list,omitempty"`
+		// Asciimath contains the recognized math in AsciiMath
+		Asciimath string `json:"asciimath,omitempty"`
+		// MathML contains the recognized math in MathML
+		MathML string `json:"mathml,omitempty"`
+		// Wolfram contains the recognized math as a Wolfram Alpha query
+		Wolfram string `json:"wolfram,omitempty"`
+		// Confidence represents the estimated probability (0-1) that the recognition is 100% correct
+		Confidence float64 `json:"confidence,omitempty"`
+		// ConfidenceRate represents the estimated confidence (0-1) of output quality
+		ConfidenceRate float64 `json:"confidence_rate,omitempty"`
+		// LatexConfidence is the confidence of the LaTeX output
+		LatexConfidence float64 `json:"latex_confidence,omitempty"`
+		// LatexConfidenceRate is the confidence rate of the LaTeX output
+		LatexConfidenceRate float64 `json:"latex_confidence_rate,omitempty"`
+		// Position is the bounding box of the recognized content
+		Position *Region `json:"position,omitempty"`
+		// DetectedAlphabets indicates which writing systems were found in the image
+		DetectedAlphabets *DetectedAlphabet `json:"detected_alphabets,omitempty"`
+		// AutoRotateConfidence represents the estimated probability (0-1) that the image needs rotation
+		AutoRotateConfidence float64 `json:"auto_rotate_confidence,omitempty"`
+		// AutoRotateDegrees suggests the rotation angle needed to correct image orientation
+		AutoRotateDegrees int `json:"auto_rotate_degrees,omitempty"`
+		// Error contains any error message in US locale format
+		Error string `json:"error,omitempty"`
+		// ErrorInfo contains detailed information about any errors that occurred
+		ErrorInfo *ErrorInfo `json:"error_info,omitempty"`
+	}
 	// PostBatchResponse is the response from the batch endpoint.
 	//
 	// The response contains only a unique batch_id value.
@@ -319,8 +506,10 @@ type (
 	}
 	// GetBatchResponse is the response from the GET /v3/batch/:id endpoint.
 	GetBatchResponse struct {
-		Keys    []string               `json:"keys"`
-		Results map[string]interface{} `json:"results"`
+		// Keys are the keys of the URLs of the batch.
+		Keys []string `json:"keys"`
+		// Results maps the keys of the processed URLs to their result.
+		Results map[string]*ImageResponse `json:"results"`
 	}
 	// DocumentResponse represents the response from the PDF processing endpoint.
 	DocumentResponse struct {
@@ -329,12 +518,18 @@ type (
 		// Error contains US locale error message if present
 		Error string `json:"error,omitempty"`
 		// ErrorInfo contains detailed error information
-		ErrorInfo map[string]interface{} `json:"error_info,omitempty"`
+		ErrorInfo *ErrorInfo `json:"error_info,omitempty"`
 	}
 	// ConversionResultResponse represents the response from the result endpoint.
 	ConversionResultResponse struct {
-		Status     ConversionStatusType                   `json:"status"`
-		Coversions map[ConversionFormats]ConversionStatus `json:"conversion_status"`
+		Status     ConversionStatusType                      `json:"status"`
+		Coversions map[DocumentOutputFormat]ConversionStatus `json:"conversion_status"`
+		// NumPages is the number of pages in the document
+		NumPages int `json:"num_pages,omitempty"`
+		// NumPagesCompleted is the number of pages processed so far
+		NumPagesCompleted int `json:"num_pages_completed,omitempty"`
+		// PercentDone is the processing progress in percent (0-100)
+		PercentDone float64 `json:"percent_done,omitempty"`
 	}
 	// AppTokenResponse represents the response from the Mathpix API when creating
 	// a temporary app token
@@ -372,6 +567,22 @@ const (
 	FormatData ResponseFormat = "data"
 	// FormatLatexStyled represents the styled Latex, returned only in cases that the whole image can be reduced to a single equation
 	FormatLatexStyled ResponseFormat = "latex_styled"
+	// LatexFormatText represents text with math delimiters
+	LatexFormatText LatexFormat = "text"
+	// LatexFormatNormal represents plain LaTeX
+	LatexFormatNormal LatexFormat = "latex_normal"
+	// LatexFormatSimplified represents simplified LaTeX
+	LatexFormatSimplified LatexFormat = "latex_simplified"
+	// LatexFormatStyled represents styled LaTeX
+	LatexFormatStyled LatexFormat = "latex_styled"
+	// LatexFormatList represents LaTeX split into a list of lines
+	LatexFormatList LatexFormat = "latex_list"
+	// LatexFormatAsciimath represents AsciiMath
+	LatexFormatAsciimath LatexFormat = "asciimath"
+	// LatexFormatMathML represents MathML
+	LatexFormatMathML LatexFormat = "mathml"
+	// LatexFormatWolfram represents a Wolfram Alpha compatible query
+	LatexFormatWolfram LatexFormat = "wolfram"
 	// JPEG represents JPEG image formats (*.jpeg, *.jpg, *.jpe)
 	JPEG ImageFormat = "jpeg"
 	// PNG represents Portable Network Graphics format (*.png)
@@ -446,6 +657,9 @@ type (
 	// ResponseFormat represents the format of the response.
 	// string
 	ResponseFormat string
+	// LatexFormat represents an output format of the v3/latex endpoint.
+	// string
+	LatexFormat string
 	// ImageFormat represents the image format of an image
 	// string
 	ImageFormat string
@@ -633,8 +847,10 @@ type (
 	// ErrorInfo provides detailed information about any errors that occurred during processing.
 	// This includes both machine-readable codes and human-readable messages.
 	ErrorInfo struct {
+		// ID is the machine-readable error id
+		ID ErrorID `json:"id,omitempty"`
 		// Code is a machine-readable error code
-		Code string `json:"code"`
+		Code string `json:"code,omitempty"`
 		// Message is a human-readable error description
 		Message string `json:"message"`
 		// Details contains any additional error-specific information
@@ -813,6 +1029,14 @@ func (f ImageFormat) String() string {
 	return string(f)
 }
 
+// ErrorID returns the ErrorID of the ErrorInfo, falling back to its Code.
+func (e *ErrorInfo) ErrorID() ErrorID {
+	if e.ID != "" {
+		return e.ID
+	}
+	return ErrorID(e.Code)
+}
+
 // NewDataOptions creates a new DataOptions instance with default values.
 // By default, all options are set to false.
 func NewDataOptions() *DataOptions {
@@ -861,6 +1085,13 @@ func (f InputFormat) String() string {
 	return string(f)
 }
 
+// ParseInputFormat returns the InputFormat for a given filename based on
+// its extension.
+func ParseInputFormat(filename string) (InputFormat, bool) {
+	f := InputFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")))
+	return f, f.IsValid()
+}
+
 // IsValid checks if the input format is supported by comparing against
 // known valid formats. Returns true if the format is supported, false otherwise.
 func (f InputFormat) IsValid() bool {
@@ -878,3 +1109,26 @@ func (f InputFormat) IsValid() bool {
 func (f DocumentOutputFormat) String() string {
 	return string(f)
 }
+
+// Extension returns the file extension used to download the OutputFormat.
+func (f DocumentOutputFormat) Extension() string {
+	switch f {
+	case DocumentFormatLaTeXZip:
+		return "tex"
+	case DocumentFormatPDFWithHTML:
+		return "pdf"
+	case DocumentFormatPDFWithLaTeX:
+		return "latex.pdf"
+	default:
+		return string(f)
+	}
+}
+
+// conversionKey returns the key of the OutputFormat in conversion_formats
+// and conversion_status.
+func (f DocumentOutputFormat) conversionKey() DocumentOutputFormat {
+	if f == DocumentFormatLaTeXZip {
+		return "tex.zip"
+	}
+	return f
+}
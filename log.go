@@ -0,0 +1,179 @@
+package mathpix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LevelTrace is the log level at which the Client logs full request and
+// response bodies.
+//
+// Request summaries are logged at slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
+
+// WithLogBodyLimit truncates the bodies logged at LevelTrace to at most n
+// bytes. Zero or a negative n logs full bodies.
+func WithLogBodyLimit(n int) ClientOption {
+	return func(c *Client) { c.logBodyLimit = n }
+}
+
+type (
+	// requestLog collects what is logged about a single attempt at a
+	// request.
+	requestLog struct {
+		endpoint string
+		attempt  int
+		start    time.Time
+		req      *http.Request
+		reqBody  []byte
+		sent     countingReader
+	}
+	// countingReader counts the bytes read through it.
+	countingReader struct {
+		io.ReadCloser
+		n int64
+	}
+)
+
+// startLog starts logging an attempt at req, capturing its body if bodies
+// are logged.
+//
+// It returns nil if the Client has no logger or debug logging is disabled.
+func (c *Client) startLog(
+	ctx context.Context,
+	endpoint string,
+	attempt int,
+	req *http.Request,
+) *requestLog {
+	if c.logger == nil || !c.logger.Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+	l := &requestLog{
+		endpoint: endpoint,
+		attempt:  attempt,
+		start:    time.Now(),
+		req:      req,
+	}
+	// Multipart bodies are streamed and never buffered for logging.
+	if req.Body != nil && c.logger.Enabled(ctx, LevelTrace) &&
+		strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err == nil {
+			l.reqBody = body
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		l.sent.ReadCloser = req.Body
+		req.Body = &l.sent
+	}
+	return l
+}
+
+// finish logs the outcome of the attempt.
+func (c *Client) finish(
+	ctx context.Context,
+	l *requestLog,
+	res *http.Response,
+	body []byte,
+	err error,
+) {
+	if l == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("endpoint", l.endpoint),
+		slog.String("method", l.req.Method),
+		slog.Int("attempt", l.attempt),
+		slog.Duration("latency", time.Since(l.start)),
+		slog.Int64("request_size", l.sent.n),
+	}
+	if res != nil {
+		attrs = append(attrs,
+			slog.Int("status", res.StatusCode),
+			slog.Int("response_size", len(body)),
+		)
+	}
+	if requestID, _ := ParseError(body); requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "mathpix request", attrs...)
+	if !c.logger.Enabled(ctx, LevelTrace) {
+		return
+	}
+	attrs = append(attrs,
+		slog.Any("request_headers", redactHeader(l.req.Header)),
+		slog.String("request_body", c.truncate(redactBody(l.reqBody))),
+	)
+	if res != nil {
+		attrs = append(attrs,
+			slog.Any("response_headers", res.Header),
+			slog.String("response_body", c.truncate(redactBody(body))),
+		)
+	}
+	c.logger.LogAttrs(ctx, LevelTrace, "mathpix request body", attrs...)
+}
+
+// truncate returns body as a string, truncated to the log body limit.
+func (c *Client) truncate(body []byte) string {
+	if c.logBodyLimit > 0 && len(body) > c.logBodyLimit {
+		return string(body[:c.logBodyLimit]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// redactHeader returns a copy of h with the credentials redacted.
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, key := range []string{"app_key", "app_token"} {
+		if v := h.Get(key); v != "" {
+			h.Set(key, redact(v))
+		}
+	}
+	return h
+}
+
+// redactBody returns body with the credentials of a JSON object, such as the
+// app_token minted by v3/app-tokens, redacted.
+//
+// Other bodies are returned as is.
+func redactBody(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	redacted := false
+	for _, key := range []string{"app_key", "app_token"} {
+		var v string
+		if json.Unmarshal(fields[key], &v) != nil || v == "" {
+			continue
+		}
+		fields[key], _ = json.Marshal(redact(v))
+		redacted = true
+	}
+	if !redacted {
+		return body
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// Read implements io.Reader, counting the bytes read.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
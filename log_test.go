@@ -0,0 +1,64 @@
+package mathpix_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestLogRedactsCredentials(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: mathpix.LevelTrace,
+	}))
+	client := srv.Client(mathpix.WithLogger(logger))
+
+	res, err := client.NewClientToken(context.Background(), &mathpix.AppTokenRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, "response_body=") {
+		t.Fatalf("response body not logged:\n%s", logs)
+	}
+	for name, secret := range map[string]string{
+		"app key":   mathpixtest.AppKey,
+		"app token": res.AppToken,
+	} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("%s %q logged:\n%s", name, secret, logs)
+		}
+	}
+}
+
+func TestLogSummaryWithoutBodies(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+	client := srv.Client(mathpix.WithLogger(logger))
+
+	if _, err := client.Image(context.Background(), &mathpix.ImageRequest{
+		SourceURL: "https://example.com/eq.png",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, "endpoint=v3/image") {
+		t.Errorf("request not logged:\n%s", logs)
+	}
+	if strings.Contains(logs, "response_body=") {
+		t.Errorf("body logged below LevelTrace:\n%s", logs)
+	}
+}
@@ -1,13 +1,14 @@
 package mathpix
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/ggicci/httpin"
 )
@@ -15,35 +16,58 @@ import (
 // Client is the main struct for the mathpix-go library.
 type (
 	Client struct {
-		apiKey  string
-		appID   string
-		baseURL url.URL
-		client  *http.Client
-		logger  *slog.Logger
+		credentials CredentialsProvider
+		baseURL     url.URL
+		client      *http.Client
+		logger      *slog.Logger
+		retry       *RetryPolicy
+		limiter     *RateLimiter
+		cache       Cache
+		cacheTTL    time.Duration
 
+		logBodyLimit int
+		middleware   []Middleware
+		dispatch     Doer
+
+		// SetCommonHeaders is called on every request after the
+		// authentication headers are set.
 		SetCommonHeaders func(req *http.Request)
 	}
 
 	// ClientOption is a function that can be used to configure a Client.
 	ClientOption func(*Client)
+
+	// replayer is implemented by request payloads that may not be sendable
+	// more than once.
+	replayer interface {
+		replayable() bool
+	}
+	// streamer is implemented by request payloads streaming their own body
+	// instead of being encoded by httpin.
+	streamer interface {
+		stream() (body io.ReadCloser, contentType string)
+	}
 )
 
 // NewClient creates a new Client with the given API key and base URL.
+//
+// The API key and app id may be left empty when the credentials are
+// provided with WithCredentials or WithTokenSource.
 func NewClient(apiKey, appID string, opts ...ClientOption) *Client {
 	baseURL, _ := url.Parse("https://api.mathpix.com")
 	client := &Client{
-		apiKey:  apiKey,
-		appID:   appID,
-		baseURL: *baseURL,
-		client:  http.DefaultClient,
+		credentials: StaticCredentials{
+			AppID:  appID,
+			AppKey: apiKey,
+		},
+		baseURL:          *baseURL,
+		client:           http.DefaultClient,
+		SetCommonHeaders: func(*http.Request) {},
 	}
 	for _, opt := range opts {
 		opt(client)
 	}
-	client.SetCommonHeaders = func(req *http.Request) {
-		req.Header.Set("app_key", client.apiKey)
-		req.Header.Set("app_id", client.appID)
-	}
+	client.dispatch = client.doer()
 	return client
 }
 
@@ -67,6 +91,12 @@ func WithClient(client *http.Client) ClientOption {
 }
 
 // call is a method that takes an endpoint and make a call to it.
+//
+// Responses that succeed but carry an error are returned together with a
+// *ResponseError (see IsPartial).
+//
+// Failed attempts are retried according to the client's RetryPolicy unless
+// the request carries a stream that can only be sent once.
 func call[Request, Response any](
 	ctx context.Context,
 	c *Client,
@@ -74,62 +104,196 @@ func call[Request, Response any](
 	request Request,
 	param string,
 ) (response Response, err error) {
-	httpReq, err := httpin.NewRequestWithContext(
-		ctx,
+	attempts := c.retry.attempts(e.method)
+	if r, ok := any(request).(replayer); ok && !r.replayable() {
+		attempts = 1
+	}
+	if single, _ := ctx.Value(singleAttemptKey{}).(bool); single {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		var res *http.Response
+		response, res, err = do(ctx, c, e, request, param, attempt)
+		if attempt >= attempts || !c.retry.retryable(res, err) {
+			return response, err
+		}
+		if serr := sleep(ctx, c.retry.backoff(attempt, res)); serr != nil {
+			return response, err
+		}
+	}
+}
+
+// do makes a single attempt at calling the endpoint.
+//
+// The returned response has its body closed and is only useful for its
+// status code and headers.
+func do[Request, Response any](
+	ctx context.Context,
+	c *Client,
+	e endpoint[Request, Response],
+	request Request,
+	param string,
+	attempt int,
+) (response Response, res *http.Response, err error) {
+	err = c.limiter.Wait(ctx, e.name)
+	if err != nil {
+		return response, nil, err
+	}
+	// Credentials are resolved before building the request, so that a
+	// failure never leaves a streaming upload body behind.
+	creds, err := c.credentials.Credentials(ctx)
+	if err != nil {
+		return response, nil, err
+	}
+	httpReq, err := newRequest(
+		withCallInfo(ctx, e.name, request, attempt),
 		e.method,
 		c.baseURL.JoinPath(e.name, param).String(),
 		request,
 	)
 	if err != nil {
-		return response, err
+		return response, nil, err
+	}
+	// Closing the body releases streaming uploads that were not fully sent,
+	// e.g. when the transport or a middleware gave up early.
+	if httpReq.Body != nil {
+		defer httpReq.Body.Close()
 	}
+	creds.setHeaders(httpReq)
 	c.SetCommonHeaders(httpReq)
 	contentType := httpReq.Header.Get("Content-Type")
 	if contentType == "" {
 		httpReq.Header.Set("Content-Type", "application/json")
 	}
-	res, err := c.client.Do(httpReq)
+	l := c.startLog(ctx, e.name, attempt, httpReq)
+	res, err = c.dispatch.Do(httpReq)
 	if err != nil {
-		return
+		c.finish(ctx, l, nil, nil, err)
+		return response, nil, err
 	}
 	defer res.Body.Close()
-	resp, apiErr, err := nopDecode[APIError](res.Body)
-	if err != nil {
-		return response, err
+	body, err := io.ReadAll(res.Body)
+	if err == nil {
+		err = responseError(e.name, res, body)
+	}
+	c.finish(ctx, l, res, body, err)
+	if err != nil && !IsPartial(err) {
+		return response, res, err
 	}
-	if res.StatusCode < http.StatusOK ||
-		res.StatusCode >= http.StatusBadRequest ||
-		isErrorID(apiErr.ID) {
-		return response, &apiErr
+	if derr := json.Unmarshal(body, &response); derr != nil {
+		return response, res, derr
 	}
-	err = json.NewDecoder(resp).Decode(&response)
+	return response, res, err
+}
+
+// newRequest creates the HTTP request of a call.
+//
+// Payloads implementing streamer provide their own body, others are encoded
+// by httpin.
+func newRequest(
+	ctx context.Context,
+	method, url string,
+	request any,
+) (*http.Request, error) {
+	s, ok := request.(streamer)
+	if !ok {
+		return httpin.NewRequestWithContext(ctx, method, url, request)
+	}
+	body, contentType := s.stream()
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return
+		body.Close()
+		return nil, err
 	}
-	return response, nil
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
 }
 
-// nopDecode decodes the request body into the given type.
-func nopDecode[T any](
-	r io.Reader,
-) (io.Reader, T, error) {
-	var (
-		buf bytes.Buffer
-		v   T
+// open sends a request without a body to the named endpoint and returns the
+// response with its body still open.
+//
+// Non-2xx responses are turned into errors.
+func open(
+	ctx context.Context,
+	c *Client,
+	method, name, param string,
+	header http.Header,
+) (*http.Response, error) {
+	if err := c.limiter.Wait(ctx, name); err != nil {
+		return nil, err
+	}
+	creds, err := c.credentials.Credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(
+		withCallInfo(ctx, name, nil, 1),
+		method,
+		c.baseURL.JoinPath(name, param).String(),
+		nil,
 	)
-	tee := io.TeeReader(r, &buf)
-	err := json.NewDecoder(tee).Decode(&v)
 	if err != nil {
-		return nil, v, err
+		return nil, err
+	}
+	for k, v := range header {
+		httpReq.Header[k] = v
+	}
+	creds.setHeaders(httpReq)
+	c.SetCommonHeaders(httpReq)
+	l := c.startLog(ctx, name, 1, httpReq)
+	res, err := c.dispatch.Do(httpReq)
+	if err != nil {
+		c.finish(ctx, l, nil, nil, err)
+		return nil, err
 	}
-	return &buf, v, nil
+	if !failedStatus(res.StatusCode) {
+		c.finish(ctx, l, res, nil, nil)
+		return res, nil
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err == nil {
+		err = responseError(name, res, body)
+	}
+	c.finish(ctx, l, res, body, err)
+	return nil, err
 }
 
 // Image sends an image to the Mathpix API.
+//
+// If the request has a File or Reader, the image data is uploaded as
+// multipart/form-data. Responses are cached if the Client has a Cache.
 func (c *Client) Image(
 	ctx context.Context,
 	request *ImageRequest,
 ) (*ImageResponse, error) {
+	if !c.caching(ctx) {
+		return c.image(ctx, request)
+	}
+	request, key, err := imageCacheKey(request)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return c.image(ctx, request)
+	}
+	return cached(ctx, c, key, func() (*ImageResponse, error) {
+		return c.image(ctx, request)
+	})
+}
+
+// image sends an image to the v3/image endpoint.
+func (c *Client) image(
+	ctx context.Context,
+	request *ImageRequest,
+) (*ImageResponse, error) {
+	if request.File != "" || request.Reader != nil {
+		payload, err := newImageUploadPayload(request)
+		if err != nil {
+			return nil, err
+		}
+		return call(ctx, c, imageUploadEndpoint, payload, "")
+	}
 	return call(
 		ctx,
 		c,
@@ -141,11 +305,63 @@ func (c *Client) Image(
 	)
 }
 
+// Text sends an image to the v3/text endpoint of the Mathpix API.
+//
+// If the request has a File or Reader, the image data is uploaded as
+// multipart/form-data.
+func (c *Client) Text(
+	ctx context.Context,
+	request *TextRequest,
+) (*ImageResponse, error) {
+	if request.File != "" || request.Reader != nil {
+		payload, err := newTextUploadPayload(request)
+		if err != nil {
+			return nil, err
+		}
+		return call(ctx, c, textUploadEndpoint, payload, "")
+	}
+	return call(
+		ctx,
+		c,
+		textEndpoint,
+		&textRequestPayload{
+			Payload: request,
+		},
+		"",
+	)
+}
+
+// Latex sends an image to the legacy v3/latex endpoint of the Mathpix API.
+func (c *Client) Latex(
+	ctx context.Context,
+	request *LatexRequest,
+) (*LatexResponse, error) {
+	return call(
+		ctx,
+		c,
+		latexEndpoint,
+		&latexRequestPayload{
+			Payload: request,
+		},
+		"",
+	)
+}
+
 // Pdf sends a PDF to the Mathpix API.
+//
+// If the request has a File or Reader, the document is streamed as
+// multipart/form-data. Any InputFormat is accepted.
 func (c *Client) Pdf(
 	ctx context.Context,
 	request *RequestDocument,
 ) (*DocumentResponse, error) {
+	if request.File != "" || request.Reader != nil {
+		payload, err := newDocumentUploadPayload(request)
+		if err != nil {
+			return nil, err
+		}
+		return call(ctx, c, documentUploadEndpoint, payload, "")
+	}
 	return call(
 		ctx,
 		c,
@@ -166,16 +382,69 @@ func (c *Client) PdfResult(
 		ctx,
 		c,
 		conversionStatusEndpoint,
-		nil,
+		&resultRequestPayload{
+			ResultRequest: *request,
+		},
 		request.PDFID,
 	)
 }
 
+// DownloadPdfResult streams the converted document in the given format
+// into w.
+//
+// It returns ErrConversionPending if the conversion is not done yet,
+// ErrFormatNotRequested if the document is processed without the format
+// and a *ConversionError if it failed.
+func (c *Client) DownloadPdfResult(
+	ctx context.Context,
+	pdfID string,
+	format DocumentOutputFormat,
+	w io.Writer,
+) error {
+	result, err := c.PdfResult(ctx, &ResultRequest{PDFID: pdfID})
+	if err != nil && !IsPartial(err) {
+		return err
+	}
+	done, err := conversionDone(
+		pdfID,
+		result,
+		[]DocumentOutputFormat{format},
+		err,
+	)
+	if err != nil {
+		return err
+	}
+	if !done {
+		return ErrConversionPending
+	}
+	res, err := open(
+		ctx,
+		c,
+		http.MethodGet,
+		documentsEndpoint.name,
+		pdfID+"."+format.Extension(),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
 // Batch sends a batch of images to the Mathpix API.
+//
+// The Callback of the request is validated before sending.
 func (c *Client) Batch(
 	ctx context.Context,
 	request *RequestPostBatch,
 ) (*PostBatchResponse, error) {
+	if request.Callback != nil {
+		if err := request.Callback.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	return call(
 		ctx,
 		c,
@@ -188,9 +457,26 @@ func (c *Client) Batch(
 }
 
 // RequestStrokes sends a strokes recognition request to the Mathpix API.
+//
+// Responses are cached if the Client has a Cache.
 func (c *Client) RequestStrokes(
 	ctx context.Context,
 	request *RequestStrokes,
+) (*StrokesResponse, error) {
+	if !c.caching(ctx) {
+		return c.requestStrokes(ctx, request)
+	}
+	key := cacheKey(sha256.New(), strokesEndpoint.name, request)
+	return cached(ctx, c, key, func() (*StrokesResponse, error) {
+		return c.requestStrokes(ctx, request)
+	})
+}
+
+// requestStrokes sends a strokes recognition request to the v3/strokes
+// endpoint.
+func (c *Client) requestStrokes(
+	ctx context.Context,
+	request *RequestStrokes,
 ) (*StrokesResponse, error) {
 	return call(
 		ctx,
@@ -244,7 +530,9 @@ func (c *Client) GetBatch(
 		ctx,
 		c,
 		getBatchEndpoint,
-		&getBatchPayload{},
+		&getBatchPayload{
+			PayloadID: batchID,
+		},
 		batchID,
 	)
 }
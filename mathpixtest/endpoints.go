@@ -0,0 +1,451 @@
+package mathpixtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+)
+
+type (
+	// Document describes a simulated document conversion.
+	Document struct {
+		// Pages are the contents of the pages in Mathpix Markdown.
+		Pages []string
+		// Polls is the number of status polls reporting the document as
+		// processing before it is done.
+		Polls int
+		// Failed makes the document fail to process.
+		Failed bool
+		// FailedFormats are the conversion formats that fail to convert.
+		FailedFormats []mathpix.DocumentOutputFormat
+	}
+	// document is the state of a submitted document.
+	document struct {
+		Document
+		formats []mathpix.DocumentOutputFormat
+		polls   int
+	}
+	// batch is the state of a submitted batch.
+	batch struct {
+		keys  []string
+		polls int
+	}
+)
+
+// AddDocument registers a document with the given pdf id, as if it had
+// been submitted with conversion of the given formats.
+func (s *Server) AddDocument(
+	pdfID string,
+	doc Document,
+	formats ...mathpix.DocumentOutputFormat,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[pdfID] = newDocument(doc, formats)
+}
+
+// QueueDocument queues documents simulated, in order, for the next
+// submitted documents instead of the one set with WithDocument.
+func (s *Server) QueueDocument(docs ...Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued = append(s.queued, docs...)
+}
+
+// serve returns the default response to req.
+//
+// s.mu must be held.
+func (s *Server) serve(req *Request) Response {
+	switch req.Method + " " + req.Endpoint {
+	case "POST v3/image", "POST v3/text":
+		return Response{Body: s.imageResponse()}
+	case "POST v3/latex":
+		image := s.imageResponse()
+		return Response{Body: mathpix.LatexResponse{
+			RequestID:      image.RequestID,
+			Text:           image.Text,
+			LatexStyled:    image.LatexStyled,
+			Confidence:     image.Confidence,
+			ConfidenceRate: image.ConfidenceRate,
+		}}
+	case "POST v3/strokes":
+		image := s.imageResponse()
+		return Response{Body: mathpix.StrokesResponse{
+			RequestID:      image.RequestID,
+			IsPrinted:      image.IsPrinted,
+			IsHandwritten:  image.IsHandwritten,
+			Confidence:     image.Confidence,
+			ConfidenceRate: image.ConfidenceRate,
+			LatexStyled:    image.LatexStyled,
+			Text:           image.Text,
+			Version:        image.Version,
+		}}
+	case "POST v3/pdf":
+		return s.submitDocument(req)
+	case "GET v3/pdf":
+		return s.downloadDocument(req)
+	case "GET v3/status":
+		return s.documentStatus(req)
+	case "POST v3/batch":
+		return s.submitBatch(req)
+	case "GET v3/batch":
+		return s.batchResults(req)
+	case "POST v3/app-tokens":
+		return s.appToken(req)
+	case "GET v3/ocr-results":
+		return Response{Body: mathpix.OCRResultsResponse{
+			OCRResults: []mathpix.OCRResult{},
+		}}
+	case "POST v3/usage":
+		return Response{Body: mathpix.UsageResponse{}}
+	default:
+		return errorResponse(
+			http.StatusMethodNotAllowed,
+			"",
+			"method not allowed",
+		)
+	}
+}
+
+// newID returns a new id with the given prefix.
+//
+// s.mu must be held.
+func (s *Server) newID(prefix string) string {
+	s.ids++
+	return prefix + "-" + strconv.Itoa(s.ids)
+}
+
+// imageResponse returns the image response with a new request id.
+//
+// s.mu must be held.
+func (s *Server) imageResponse() mathpix.ImageResponse {
+	res := s.image
+	res.RequestID = s.newID("request")
+	return res
+}
+
+// submitDocument starts simulating a submitted document.
+//
+// s.mu must be held.
+func (s *Server) submitDocument(req *Request) Response {
+	var opts mathpix.RequestDocument
+	if err := req.Decode(&opts); err != nil {
+		return errorResponse(
+			http.StatusBadRequest,
+			mathpix.ErrJSONSyntax,
+			err.Error(),
+		)
+	}
+	if opts.URL == "" && req.File == nil {
+		return errorResponse(
+			http.StatusOK,
+			mathpix.ErrPDFMissing,
+			"request has no url or file",
+		)
+	}
+	doc := s.document
+	if len(s.queued) > 0 {
+		doc, s.queued = s.queued[0], s.queued[1:]
+	}
+	pdfID := s.newID("pdf")
+	s.documents[pdfID] = newDocument(
+		doc,
+		requestedFormats(opts.ConversionFormats),
+	)
+	return Response{Body: mathpix.DocumentResponse{PDFID: pdfID}}
+}
+
+// documentStatus advances the simulation of a document and returns its
+// status.
+//
+// s.mu must be held.
+func (s *Server) documentStatus(req *Request) Response {
+	doc, ok := s.documents[req.Param]
+	if !ok {
+		return unknownDocument(req.Param)
+	}
+	doc.polls++
+	completed := len(doc.Pages) * (doc.polls - 1) / max(doc.Polls, 1)
+	res := mathpix.ConversionResultResponse{
+		Status:            mathpix.ConversionStatusProcessing,
+		NumPages:          len(doc.Pages),
+		NumPagesCompleted: completed,
+	}
+	if doc.done() {
+		res.Status = mathpix.ConversionStatusCompleted
+		res.NumPagesCompleted = len(doc.Pages)
+		if doc.Failed {
+			res.Status = mathpix.ConversionStatusError
+		}
+	}
+	if res.NumPages > 0 {
+		res.PercentDone = 100 * float64(res.NumPagesCompleted) /
+			float64(res.NumPages)
+	}
+	if len(doc.formats) == 0 {
+		return Response{Body: res}
+	}
+	res.Coversions = make(
+		map[mathpix.DocumentOutputFormat]mathpix.ConversionStatus,
+	)
+	for _, format := range doc.formats {
+		status := mathpix.ConversionStatusProcessing
+		switch {
+		case !doc.done():
+		case doc.Failed || doc.failed(format):
+			status = mathpix.ConversionStatusError
+		default:
+			status = mathpix.ConversionStatusCompleted
+		}
+		res.Coversions[conversionKey(format)] = mathpix.ConversionStatus{
+			Status: status,
+		}
+	}
+	return Response{Body: res}
+}
+
+// downloadDocument returns a converted document, its lines JSON or its
+// page stream.
+//
+// s.mu must be held.
+func (s *Server) downloadDocument(req *Request) Response {
+	if pdfID, ok := strings.CutSuffix(req.Param, "/stream"); ok {
+		return s.streamDocument(req, pdfID)
+	}
+	pdfID, ext, _ := strings.Cut(req.Param, ".")
+	doc, ok := s.documents[pdfID]
+	if !ok {
+		return unknownDocument(pdfID)
+	}
+	if !doc.done() || doc.Failed {
+		return errorResponse(
+			http.StatusNotFound,
+			"",
+			"document "+pdfID+" is not processed",
+		)
+	}
+	switch ext {
+	case "mmd", "md":
+		return Response{
+			Header: http.Header{"Content-Type": {"text/plain"}},
+			Body:   strings.Join(doc.Pages, "\n\n"),
+		}
+	case "lines.json":
+		return Response{Body: doc.lines(pdfID)}
+	}
+	for _, format := range doc.formats {
+		if format.Extension() != ext || doc.failed(format) {
+			continue
+		}
+		return Response{
+			Header: http.Header{"Content-Type": {"application/octet-stream"}},
+			Body:   fmt.Sprintf("mathpixtest %s output of %s", format, pdfID),
+		}
+	}
+	return errorResponse(
+		http.StatusNotFound,
+		"",
+		"no "+ext+" output for document "+pdfID,
+	)
+}
+
+// streamDocument returns the pages of a document as server-sent events,
+// resuming after the Last-Event-ID of the request.
+//
+// s.mu must be held.
+func (s *Server) streamDocument(req *Request, pdfID string) Response {
+	doc, ok := s.documents[pdfID]
+	if !ok {
+		return unknownDocument(pdfID)
+	}
+	last, _ := strconv.Atoi(req.Header.Get("Last-Event-ID"))
+	var b strings.Builder
+	for i := last; i < len(doc.Pages); i++ {
+		data, _ := json.Marshal(mathpix.PdfStreamEvent{
+			Text:           doc.Pages[i],
+			PageIdx:        i + 1,
+			PdfSelectedLen: len(doc.Pages),
+		})
+		fmt.Fprintf(&b, "id: %d\ndata: %s\n\n", i+1, data)
+	}
+	return Response{
+		Header: http.Header{"Content-Type": {"text/event-stream"}},
+		Body:   b.String(),
+	}
+}
+
+// submitBatch starts simulating a submitted batch.
+//
+// s.mu must be held.
+func (s *Server) submitBatch(req *Request) Response {
+	var opts mathpix.RequestPostBatch
+	if err := req.Decode(&opts); err != nil {
+		return errorResponse(
+			http.StatusBadRequest,
+			mathpix.ErrJSONSyntax,
+			err.Error(),
+		)
+	}
+	if opts.Callback != nil {
+		if err := opts.Callback.Validate(); err != nil {
+			return errorResponse(
+				http.StatusOK,
+				mathpix.ErrOptsBadCallback,
+				err.Error(),
+			)
+		}
+	}
+	b := &batch{}
+	for key := range opts.URLs {
+		b.keys = append(b.keys, key)
+	}
+	slices.Sort(b.keys)
+	batchID := s.newID("batch")
+	s.batches[batchID] = b
+	return Response{Body: mathpix.PostBatchResponse{BatchID: batchID}}
+}
+
+// batchResults advances the simulation of a batch and returns the results
+// available so far.
+//
+// s.mu must be held.
+func (s *Server) batchResults(req *Request) Response {
+	b, ok := s.batches[req.Param]
+	if !ok {
+		return errorResponse(
+			http.StatusOK,
+			mathpix.ErrBatchUnknownID,
+			"unknown batch "+req.Param,
+		)
+	}
+	b.polls++
+	done := min(len(b.keys), len(b.keys)*b.polls/(s.batchPolls+1))
+	res := mathpix.GetBatchResponse{
+		Keys:    b.keys,
+		Results: make(map[string]*mathpix.ImageResponse, done),
+	}
+	for _, key := range b.keys[:done] {
+		image := s.imageResponse()
+		res.Results[key] = &image
+	}
+	return Response{Body: res}
+}
+
+// appToken mints a new app token.
+//
+// s.mu must be held.
+func (s *Server) appToken(req *Request) Response {
+	var opts mathpix.AppTokenRequest
+	if err := req.Decode(&opts); err != nil {
+		return errorResponse(
+			http.StatusBadRequest,
+			mathpix.ErrJSONSyntax,
+			err.Error(),
+		)
+	}
+	expires := opts.Expires
+	if expires <= 0 {
+		expires = 300
+	}
+	res := mathpix.AppTokenResponse{
+		AppToken:          s.newID("token"),
+		AppTokenExpiresAt: time.Now().Unix() + expires,
+	}
+	if opts.IncludeStrokesSessionID {
+		res.StrokesSessionID = s.newID("strokes-session")
+	}
+	return Response{Body: res}
+}
+
+// newDocument creates the state of a document converted to formats.
+func newDocument(
+	doc Document,
+	formats []mathpix.DocumentOutputFormat,
+) *document {
+	return &document{Document: doc, formats: formats}
+}
+
+// done reports whether the document is done processing.
+func (d *document) done() bool {
+	return d.polls > d.Polls
+}
+
+// failed reports whether the conversion to format fails.
+func (d *document) failed(format mathpix.DocumentOutputFormat) bool {
+	return slices.Contains(d.FailedFormats, format)
+}
+
+// lines returns the lines JSON of the document.
+func (d *document) lines(pdfID string) mathpix.PdfLinesResponse {
+	res := mathpix.PdfLinesResponse{Pages: []mathpix.PdfPage{}}
+	for i, text := range d.Pages {
+		res.Pages = append(res.Pages, mathpix.PdfPage{
+			ImageID:    fmt.Sprintf("%s-%d", pdfID, i+1),
+			Page:       i + 1,
+			PageWidth:  1224,
+			PageHeight: 1584,
+			Lines: []mathpix.PdfLine{{
+				ID:               fmt.Sprintf("%s-%d-1", pdfID, i+1),
+				Type:             "text",
+				Line:             1,
+				Region:           mathpix.Region{Width: 1224, Height: 1584},
+				Text:             text,
+				IsPrinted:        true,
+				ConversionOutput: true,
+				Confidence:       1,
+				ConfidenceRate:   1,
+			}},
+		})
+	}
+	return res
+}
+
+// requestedFormats returns the conversion formats requested by formats.
+func requestedFormats(
+	formats mathpix.ConversionFormats,
+) []mathpix.DocumentOutputFormat {
+	var requested []mathpix.DocumentOutputFormat
+	for _, f := range []struct {
+		on     bool
+		format mathpix.DocumentOutputFormat
+	}{
+		{formats.MMD, mathpix.DocumentFormatMMD},
+		{formats.MD, mathpix.DocumentFormatMD},
+		{formats.DOCX, mathpix.DocumentFormatDOCX},
+		{formats.TeXZip, mathpix.DocumentFormatLaTeXZip},
+		{formats.HTML, mathpix.DocumentFormatHTML},
+		{formats.PDFWithHTML, mathpix.DocumentFormatPDFWithHTML},
+		{formats.PDFWithLaTeX, mathpix.DocumentFormatPDFWithLaTeX},
+	} {
+		if f.on {
+			requested = append(requested, f.format)
+		}
+	}
+	return requested
+}
+
+// conversionKey returns the key of format in conversion statuses.
+func conversionKey(
+	format mathpix.DocumentOutputFormat,
+) mathpix.DocumentOutputFormat {
+	if format == mathpix.DocumentFormatLaTeXZip {
+		return "tex.zip"
+	}
+	return format
+}
+
+// unknownDocument returns the response to a request for an unknown
+// document.
+func unknownDocument(pdfID string) Response {
+	return errorResponse(
+		http.StatusOK,
+		mathpix.ErrPDFUnknownID,
+		"unknown pdf id "+pdfID,
+	)
+}
@@ -0,0 +1,359 @@
+package mathpixtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// EnvRecord is the environment variable that makes recorders record new
+// cassettes when set to a non-empty value.
+const EnvRecord = "MATHPIX_RECORD"
+
+// redacted replaces scrubbed credentials in cassettes.
+const redacted = "REDACTED"
+
+// ErrCassetteMissing is returned by NewRecorder when replaying a cassette
+// that does not exist.
+var ErrCassetteMissing = errors.New("mathpixtest: cassette is missing")
+
+// scrubbedHeaders are the request headers carrying credentials.
+var scrubbedHeaders = []string{"app_key", "app_token", "Authorization"}
+
+type (
+	// Recorder is an http.RoundTripper that records the interactions of a
+	// Client with the Mathpix API into a cassette file and replays them.
+	//
+	// Use it with mathpix.WithClient(recorder.Client()). It is safe for
+	// concurrent use.
+	Recorder struct {
+		path      string
+		record    bool
+		transport http.RoundTripper
+		scrub     func(*Interaction)
+
+		mu       sync.Mutex
+		cassette Cassette
+		used     []bool
+	}
+	// RecorderOption configures a Recorder.
+	RecorderOption func(*Recorder)
+	// Cassette is the content of a cassette file.
+	Cassette struct {
+		// Interactions are the recorded interactions, in order.
+		Interactions []Interaction `json:"interactions"`
+	}
+	// Interaction is a recorded request and its response.
+	Interaction struct {
+		Request  InteractionRequest  `json:"request"`
+		Response InteractionResponse `json:"response"`
+	}
+	// InteractionRequest is a recorded request.
+	InteractionRequest struct {
+		// Method is the HTTP method of the request.
+		Method string `json:"method"`
+		// Path is the path and query of the request URL.
+		Path string `json:"path"`
+		// Header holds the request headers, with credentials scrubbed.
+		Header http.Header `json:"header,omitempty"`
+		// Body is the request body.
+		Body Body `json:"body"`
+	}
+	// InteractionResponse is a recorded response.
+	InteractionResponse struct {
+		// StatusCode is the HTTP status code of the response.
+		StatusCode int `json:"status_code"`
+		// Header holds the response headers.
+		Header http.Header `json:"header,omitempty"`
+		// Body is the response body.
+		Body Body `json:"body"`
+	}
+	// Body is a recorded body.
+	//
+	// Only one of its fields is set, depending on the content of the body.
+	Body struct {
+		// JSON holds bodies that are valid JSON.
+		JSON json.RawMessage `json:"json,omitempty"`
+		// Text holds other UTF-8 bodies.
+		Text string `json:"text,omitempty"`
+		// Base64 holds binary bodies.
+		Base64 []byte `json:"base64,omitempty"`
+	}
+)
+
+// NewRecorder creates a Recorder for the cassette file at path.
+//
+// The recorder replays the cassette unless recording is enabled with
+// WithRecording or the MATHPIX_RECORD environment variable, in which case
+// it records a new cassette, written by Close. It returns an error wrapping
+// ErrCassetteMissing if the cassette must be replayed but does not exist.
+func NewRecorder(path string, opts ...RecorderOption) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		record:    os.Getenv(EnvRecord) != "",
+		transport: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.record {
+		return r, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf(
+			"%w: %s (set %s to record it)",
+			ErrCassetteMissing,
+			path,
+			EnvRecord,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &r.cassette); err != nil {
+		return nil, fmt.Errorf("mathpixtest: decoding %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// WithRecording sets whether the recorder records a new cassette instead of
+// replaying it, overriding the MATHPIX_RECORD environment variable.
+func WithRecording(record bool) RecorderOption {
+	return func(r *Recorder) { r.record = record }
+}
+
+// WithTransport sets the transport used to send requests while recording.
+// Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) RecorderOption {
+	return func(r *Recorder) { r.transport = transport }
+}
+
+// WithScrubber adds a function called on every recorded interaction before
+// it is saved, after the credentials have been scrubbed.
+func WithScrubber(scrub func(*Interaction)) RecorderOption {
+	return func(r *Recorder) { r.scrub = scrub }
+}
+
+// Recording reports whether the recorder records a new cassette.
+func (r *Recorder) Recording() bool {
+	return r.record
+}
+
+// Client returns an http.Client sending its requests through the recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Close writes the cassette if the recorder is recording.
+func (r *Recorder) Close() error {
+	if !r.record {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(b, '\n'), 0o644)
+}
+
+// RoundTrip implements http.RoundTripper.
+//
+// While replaying, requests are matched with the first unused interaction
+// with the same method, path and normalized body.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.record {
+		return r.recordTrip(req, body)
+	}
+	return r.replay(req, body)
+}
+
+// recordTrip sends req with the given body and records the interaction.
+func (r *Recorder) recordTrip(
+	req *http.Request,
+	body []byte,
+) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	res, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	i := Interaction{
+		Request: InteractionRequest{
+			Method: req.Method,
+			Path:   req.URL.RequestURI(),
+			Header: req.Header.Clone(),
+			Body:   newBody(body),
+		},
+		Response: InteractionResponse{
+			StatusCode: res.StatusCode,
+			Header:     res.Header.Clone(),
+			Body:       newBody(resBody),
+		},
+	}
+	scrub(&i)
+	if r.scrub != nil {
+		r.scrub(&i)
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+	return res, nil
+}
+
+// replay returns the recorded response to req with the given body.
+func (r *Recorder) replay(
+	req *http.Request,
+	body []byte,
+) (*http.Response, error) {
+	key := normalize(req.Header.Get("Content-Type"), body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n, i := range r.cassette.Interactions {
+		if r.used[n] ||
+			i.Request.Method != req.Method ||
+			i.Request.Path != req.URL.RequestURI() ||
+			normalize(
+				i.Request.Header.Get("Content-Type"),
+				i.Request.Body.bytes(),
+			) != key {
+			continue
+		}
+		r.used[n] = true
+		resBody := i.Response.Body.bytes()
+		// JSON bodies are re-indented in cassettes.
+		header := i.Response.Header.Clone()
+		header.Del("Content-Length")
+		return &http.Response{
+			Status: fmt.Sprintf(
+				"%d %s",
+				i.Response.StatusCode,
+				http.StatusText(i.Response.StatusCode),
+			),
+			StatusCode:    i.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(resBody)),
+			ContentLength: int64(len(resBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf(
+		"mathpixtest: no recorded interaction for %s %s in %s",
+		req.Method,
+		req.URL.RequestURI(),
+		r.path,
+	)
+}
+
+// scrub removes the credentials from the interaction.
+//
+// App tokens minted by v3/app-tokens are scrubbed from the response body.
+func scrub(i *Interaction) {
+	for _, name := range scrubbedHeaders {
+		if i.Request.Header.Get(name) != "" {
+			i.Request.Header.Set(name, redacted)
+		}
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(i.Response.Body.JSON, &fields) != nil {
+		return
+	}
+	if _, ok := fields["app_token"]; !ok {
+		return
+	}
+	fields["app_token"], _ = json.Marshal(redacted)
+	i.Response.Body.JSON, _ = json.Marshal(fields)
+}
+
+// newBody records b.
+func newBody(b []byte) Body {
+	switch {
+	case len(b) == 0:
+		return Body{}
+	case json.Valid(b):
+		return Body{JSON: b}
+	case utf8.Valid(b):
+		return Body{Text: string(b)}
+	default:
+		return Body{Base64: b}
+	}
+}
+
+// bytes returns the recorded body.
+func (b Body) bytes() []byte {
+	switch {
+	case b.JSON != nil:
+		return b.JSON
+	case b.Base64 != nil:
+		return b.Base64
+	default:
+		return []byte(b.Text)
+	}
+}
+
+// normalize returns a canonical form of a body with the given content type.
+//
+// JSON bodies are re-encoded with sorted keys and multipart bodies are
+// reduced to their fields, so that bodies differing only in formatting or
+// multipart boundary are equal.
+func normalize(contentType string, body []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if mediaType == "multipart/form-data" {
+		fields := make(map[string]string)
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := io.ReadAll(part)
+			fields[part.FormName()] = normalize("", b)
+		}
+		b, _ := json.Marshal(fields)
+		return string(b)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if dec.Decode(&v) != nil || dec.More() {
+		return strings.TrimSpace(string(body))
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,78 @@
+package mathpixtest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestRecorderReplay(t *testing.T) {
+	dir := t.TempDir()
+	cassette := filepath.Join(dir, "image.json")
+	image := filepath.Join(dir, "eq.png")
+	if err := os.WriteFile(image, []byte("png data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	requests := []*mathpix.ImageRequest{
+		{SourceURL: "https://example.com/eq.png"},
+		{File: image},
+	}
+
+	srv := mathpixtest.NewServer(mathpixtest.WithImageResponse(
+		mathpix.ImageResponse{Text: "x^2"},
+	))
+	rec, err := mathpixtest.NewRecorder(cassette, mathpixtest.WithRecording(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := srv.Client(mathpix.WithClient(rec.Client()))
+	for _, request := range requests {
+		if _, err = client.Image(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	b, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(mathpixtest.AppKey)) {
+		t.Error("cassette contains the app key")
+	}
+
+	rec, err = mathpixtest.NewRecorder(cassette, mathpixtest.WithRecording(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = mathpix.NewClient(mathpixtest.AppKey, mathpixtest.AppID,
+		mathpix.WithBaseURL(srv.URL),
+		mathpix.WithClient(rec.Client()),
+	)
+	for _, request := range requests {
+		res, err := client.Image(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Text != "x^2" {
+			t.Errorf("replayed text %q, want %q", res.Text, "x^2")
+		}
+	}
+}
+
+func TestRecorderMissingCassette(t *testing.T) {
+	t.Setenv(mathpixtest.EnvRecord, "")
+	_, err := mathpixtest.NewRecorder(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, mathpixtest.ErrCassetteMissing) {
+		t.Fatalf("got error %v, want %v", err, mathpixtest.ErrCassetteMissing)
+	}
+}
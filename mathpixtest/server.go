@@ -0,0 +1,464 @@
+// Package mathpixtest provides an in-process fake of the Mathpix API for
+// testing code built on mathpix-go.
+//
+// A Server speaks every endpoint wired up by mathpix.Client. Its responses
+// can be scripted per endpoint, documents go through simulated processing
+// states, and every request is recorded for assertions:
+//
+//	srv := mathpixtest.NewServer()
+//	defer srv.Close()
+//	srv.Fail("v3/image", mathpix.ErrImageDecode)
+//	client := srv.Client()
+//	_, err := client.Image(ctx, &mathpix.ImageRequest{SourceURL: src})
+//	// errors.Is(err, mathpix.ErrImageDecode) == true
+//
+// Endpoints are identified by the names used by the client (e.g. "v3/pdf").
+// A name may be prefixed with a method (e.g. "GET v3/batch") to only match
+// requests sent with that method.
+package mathpixtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+)
+
+const (
+	// AppID is the app id used by clients created with Server.Client.
+	AppID = "mathpixtest"
+	// AppKey is the app key used by clients created with Server.Client.
+	AppKey = "mathpixtest-key"
+)
+
+// endpoints are the names of the endpoints served by a Server.
+var endpoints = []string{
+	"v3/image",
+	"v3/text",
+	"v3/latex",
+	"v3/pdf",
+	"v3/status",
+	"v3/batch",
+	"v3/strokes",
+	"v3/app-tokens",
+	"v3/ocr-results",
+	"v3/usage",
+}
+
+type (
+	// Server is a fake Mathpix API server.
+	//
+	// It is safe for concurrent use.
+	Server struct {
+		// URL is the base URL of the server, suitable for mathpix.WithBaseURL.
+		URL string
+
+		srv        *httptest.Server
+		mu         sync.Mutex
+		requests   []*Request
+		responses  map[string][]Response
+		failures   map[string][]mathpix.ErrorID
+		handlers   map[string]http.Handler
+		limiter    *mathpix.RateLimiter
+		image      mathpix.ImageResponse
+		document   Document
+		queued     []Document
+		documents  map[string]*document
+		batchPolls int
+		batches    map[string]*batch
+		ids        int
+	}
+	// Option configures a Server.
+	Option func(*Server)
+	// Response is a scripted response.
+	Response struct {
+		// StatusCode is the HTTP status code of the response.
+		// Defaults to 200.
+		StatusCode int
+		// Header is added to the response headers.
+		Header http.Header
+		// Body is the response body. Strings and byte slices are sent as is,
+		// other values are encoded as JSON.
+		Body any
+	}
+	// Request is a request recorded by a Server.
+	Request struct {
+		// Endpoint is the name of the called endpoint (e.g. "v3/pdf").
+		Endpoint string
+		// Method is the HTTP method of the request.
+		Method string
+		// Param is the path following the endpoint name (e.g. a pdf id).
+		Param string
+		// Header holds the request headers.
+		Header http.Header
+		// Query holds the query parameters.
+		Query url.Values
+		// Body is the raw request body.
+		Body []byte
+		// Options is the options_json form field of multipart uploads.
+		Options []byte
+		// File is the uploaded file of multipart uploads.
+		File []byte
+		// Filename is the name of the uploaded file.
+		Filename string
+	}
+)
+
+// NewServer starts a new Server.
+//
+// The server must be closed with Close when done.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		responses: make(map[string][]Response),
+		failures:  make(map[string][]mathpix.ErrorID),
+		handlers:  make(map[string]http.Handler),
+		image: mathpix.ImageResponse{
+			Text:           `\( x^{2} \)`,
+			LatexStyled:    "x^{2}",
+			Confidence:     1,
+			ConfidenceRate: 1,
+			IsPrinted:      true,
+			Version:        "mathpixtest",
+		},
+		document: Document{
+			Pages: []string{"# Title\n\nHello \\( x^{2} \\)"},
+			Polls: 1,
+		},
+		documents: make(map[string]*document),
+		batches:   make(map[string]*batch),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// WithRateLimit limits the rate of requests the server accepts.
+//
+// perEndpoint maps endpoint names to their own limits, other endpoints use
+// fallback. Requests over the limit are answered with 429 and a
+// Retry-After header.
+func WithRateLimit(
+	fallback mathpix.RateLimit,
+	perEndpoint map[string]mathpix.RateLimit,
+) Option {
+	return func(s *Server) {
+		s.limiter = mathpix.NewRateLimiter(fallback, perEndpoint)
+	}
+}
+
+// WithImageResponse sets the response of the image recognition endpoints
+// and of batch results.
+//
+// The request id is filled in for every response.
+func WithImageResponse(res mathpix.ImageResponse) Option {
+	return func(s *Server) { s.image = res }
+}
+
+// WithDocument sets the document simulated for uploaded documents.
+//
+// Defaults to a single page document that is processing on the first
+// status poll and completed afterwards.
+func WithDocument(doc Document) Option {
+	return func(s *Server) { s.document = doc }
+}
+
+// WithBatchPolls sets the number of polls of a batch before all of its
+// results are available. Results become available progressively.
+//
+// Defaults to 0, making results available on the first poll.
+func WithBatchPolls(n int) Option {
+	return func(s *Server) { s.batchPolls = n }
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a mathpix.Client sending its requests to the server.
+//
+// The options are applied after the base URL and HTTP client are set.
+func (s *Server) Client(opts ...mathpix.ClientOption) *mathpix.Client {
+	return mathpix.NewClient(
+		AppKey,
+		AppID,
+		append([]mathpix.ClientOption{
+			mathpix.WithBaseURL(s.URL),
+			mathpix.WithClient(s.srv.Client()),
+		}, opts...)...,
+	)
+}
+
+// Respond queues responses returned, in order, by the next requests to the
+// endpoint instead of the default behaviour.
+func (s *Server) Respond(endpoint string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[endpoint] = append(s.responses[endpoint], responses...)
+}
+
+// Fail makes the next requests to the endpoint fail, in order, with the
+// given errors.
+//
+// The status code of a failure is the one Mathpix uses for the ErrorID.
+func (s *Server) Fail(endpoint string, ids ...mathpix.ErrorID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], ids...)
+}
+
+// Handle replaces the default behaviour of the endpoint with h.
+//
+// Failures and queued responses still take precedence over h.
+func (s *Server) Handle(endpoint string, h http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[endpoint] = h
+}
+
+// Requests returns the requests received by the server.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received by the server for the endpoint.
+func (s *Server) RequestsTo(endpoint string) []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var requests []*Request
+	for _, req := range s.requests {
+		if req.matches(endpoint) {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// Decode decodes the JSON options of the request into v.
+//
+// The options are the options_json field of multipart uploads and the body
+// of other requests.
+func (r *Request) Decode(v any) error {
+	if r.Options != nil {
+		return json.Unmarshal(r.Options, v)
+	}
+	return json.Unmarshal(r.Body, v)
+}
+
+// matches reports whether the request is sent to the endpoint, optionally
+// prefixed with a method.
+func (r *Request) matches(endpoint string) bool {
+	return endpoint == r.Endpoint || endpoint == r.Method+" "+r.Endpoint
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, param, ok := route(r.URL.Path)
+	if !ok {
+		write(w, errorResponse(
+			http.StatusNotFound,
+			"",
+			"unknown endpoint "+r.URL.Path,
+		))
+		return
+	}
+	req, err := newRequest(name, param, r)
+	if err != nil {
+		write(w, errorResponse(
+			http.StatusBadRequest,
+			mathpix.ErrJSONSyntax,
+			err.Error(),
+		))
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	res, h := s.respond(req)
+	s.mu.Unlock()
+	if h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	write(w, res)
+}
+
+// respond returns the response to req, or the handler serving it.
+//
+// s.mu must be held.
+func (s *Server) respond(req *Request) (Response, http.Handler) {
+	if !authenticated(req.Header) {
+		return errorResponse(
+			http.StatusUnauthorized,
+			mathpix.ErrHTTPUnauthorized,
+			"invalid credentials",
+		), nil
+	}
+	if s.limiter != nil {
+		if d := s.limiter.Delay(req.Endpoint); d > 0 {
+			res := errorResponse(
+				http.StatusTooManyRequests,
+				mathpix.ErrHTTPMaxRequests,
+				"too many requests",
+			)
+			res.Header = http.Header{"Retry-After": {
+				strconv.Itoa(int(math.Ceil(d.Seconds()))),
+			}}
+			return res, nil
+		}
+		_ = s.limiter.Wait(context.Background(), req.Endpoint)
+	}
+	if id, ok := shift(s.failures, req); ok {
+		return errorResponse(statusCode(id), id, "mathpixtest: "+id.String()), nil
+	}
+	if res, ok := shift(s.responses, req); ok {
+		return res, nil
+	}
+	for _, key := range []string{req.Method + " " + req.Endpoint, req.Endpoint} {
+		if h, ok := s.handlers[key]; ok {
+			return Response{}, h
+		}
+	}
+	return s.serve(req), nil
+}
+
+// shift removes and returns the first value queued for the request.
+func shift[T any](m map[string][]T, req *Request) (v T, ok bool) {
+	for _, key := range []string{req.Method + " " + req.Endpoint, req.Endpoint} {
+		if queue := m[key]; len(queue) > 0 {
+			m[key] = queue[1:]
+			return queue[0], true
+		}
+	}
+	return v, false
+}
+
+// newRequest records r, sent to the named endpoint.
+//
+// The body of r is replaced so that it can still be read by handlers.
+func newRequest(name, param string, r *http.Request) (*Request, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	req := &Request{
+		Endpoint: name,
+		Method:   r.Method,
+		Param:    param,
+		Header:   r.Header.Clone(),
+		Query:    r.URL.Query(),
+		Body:     body,
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return req, nil
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return req, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		switch part.FormName() {
+		case "file":
+			req.File, req.Filename = b, part.FileName()
+		case "options_json":
+			req.Options = b
+		}
+	}
+}
+
+// route splits a request path into the endpoint name and its parameter.
+func route(path string) (name, param string, ok bool) {
+	path = strings.TrimPrefix(path, "/")
+	for _, name := range endpoints {
+		if path == name {
+			return name, "", true
+		}
+		if param, ok := strings.CutPrefix(path, name+"/"); ok {
+			return name, param, true
+		}
+	}
+	return "", "", false
+}
+
+// authenticated reports whether the headers carry credentials.
+func authenticated(header http.Header) bool {
+	return header.Get("app_token") != "" ||
+		(header.Get("app_key") != "" && header.Get("app_id") != "")
+}
+
+// statusCode returns the status code of a response failing with id.
+func statusCode(id mathpix.ErrorID) int {
+	if id == mathpix.ErrSysException {
+		return http.StatusInternalServerError
+	}
+	return id.HTTPStatusCode()
+}
+
+// errorResponse returns a response carrying an error in the shape used by
+// Mathpix.
+func errorResponse(code int, id mathpix.ErrorID, msg string) Response {
+	return Response{
+		StatusCode: code,
+		Body: map[string]any{
+			"error":      msg,
+			"error_info": mathpix.ErrorInfo{ID: id, Message: msg},
+		},
+	}
+}
+
+// write writes res to w.
+func write(w http.ResponseWriter, res Response) {
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	var body []byte
+	switch b := res.Body.(type) {
+	case nil:
+	case []byte:
+		body = b
+	case string:
+		body = []byte(b)
+	default:
+		var err error
+		if body, err = json.Marshal(b); err != nil {
+			http.Error(w, fmt.Sprintf("mathpixtest: %v", err), 500)
+			return
+		}
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+	code := res.StatusCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,103 @@
+package mathpixtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestServerRejectsMissingCredentials(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	client := mathpix.NewClient("", "", mathpix.WithBaseURL(srv.URL))
+
+	_, err := client.Image(context.Background(), &mathpix.ImageRequest{
+		SourceURL: "https://example.com/eq.png",
+	})
+	if !mathpix.IsAuth(err) {
+		t.Fatalf("got error %v, want an auth error", err)
+	}
+}
+
+func TestServerScriptedResponses(t *testing.T) {
+	srv := mathpixtest.NewServer(mathpixtest.WithImageResponse(
+		mathpix.ImageResponse{Text: "x^2"},
+	))
+	defer srv.Close()
+	srv.Fail("v3/image", mathpix.ErrImageDecode)
+	srv.Respond("v3/image", mathpixtest.Response{
+		Body: mathpix.ImageResponse{Text: "scripted"},
+	})
+	client := srv.Client()
+	request := &mathpix.ImageRequest{SourceURL: "https://example.com/eq.png"}
+
+	if _, err := client.Image(context.Background(), request); !errors.Is(err, mathpix.ErrImageDecode) {
+		t.Errorf("got error %v, want %v", err, mathpix.ErrImageDecode)
+	}
+	for _, want := range []string{"scripted", "x^2"} {
+		res, err := client.Image(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Text != want {
+			t.Errorf("got text %q, want %q", res.Text, want)
+		}
+	}
+	if n := len(srv.RequestsTo("POST v3/image")); n != 3 {
+		t.Errorf("recorded %d requests, want 3", n)
+	}
+}
+
+func TestServerDocument(t *testing.T) {
+	srv := mathpixtest.NewServer(mathpixtest.WithDocument(mathpixtest.Document{
+		Pages: []string{"# Title"},
+		Polls: 1,
+	}))
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	res, err := client.Pdf(ctx, &mathpix.RequestDocument{
+		URL: "https://example.com/paper.pdf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.PdfResult(ctx, &mathpix.ResultRequest{PDFID: res.PDFID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != mathpix.ConversionStatusProcessing {
+		t.Errorf("got status %q, want %q", result.Status, mathpix.ConversionStatusProcessing)
+	}
+	result, err = client.PdfResult(ctx, &mathpix.ResultRequest{PDFID: res.PDFID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != mathpix.ConversionStatusCompleted {
+		t.Errorf("got status %q, want %q", result.Status, mathpix.ConversionStatusCompleted)
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	srv := mathpixtest.NewServer(mathpixtest.WithRateLimit(
+		mathpix.RateLimit{},
+		map[string]mathpix.RateLimit{"v3/image": {Rate: 0.1, Burst: 1}},
+	))
+	defer srv.Close()
+	client := srv.Client()
+	request := &mathpix.ImageRequest{SourceURL: "https://example.com/eq.png"}
+
+	if _, err := client.Image(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Image(context.Background(), request)
+	var respErr *mathpix.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got error %v, want a 429 response", err)
+	}
+}
@@ -0,0 +1,97 @@
+package mathpix
+
+import (
+	"context"
+	"net/http"
+)
+
+type (
+	// Doer sends an HTTP request and returns its response.
+	//
+	// *http.Client implements Doer.
+	Doer interface {
+		Do(req *http.Request) (*http.Response, error)
+	}
+	// DoerFunc is an adapter to allow the use of ordinary functions as Doers.
+	DoerFunc func(req *http.Request) (*http.Response, error)
+	// Middleware wraps the Doer that dispatches the requests of a Client.
+	Middleware func(next Doer) Doer
+	// CallInfo describes the call a request is sent for.
+	//
+	// It is available to middlewares through CallInfoFromContext.
+	CallInfo struct {
+		// Endpoint is the name of the called endpoint (e.g. "v3/text").
+		Endpoint string
+		// Request is the typed request of the call (e.g. *TextRequest).
+		// It is nil for calls without a request body.
+		Request any
+		// Attempt is the attempt number of the request, starting at 1.
+		Attempt int
+	}
+	// callInfoKey is the context key of the CallInfo.
+	callInfoKey struct{}
+	// inputer is implemented by payloads to expose their typed request.
+	inputer interface {
+		input() any
+	}
+)
+
+// WithMiddleware adds middlewares wrapping the dispatch of every request.
+//
+// The first middleware is the outermost one and sees requests first.
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// CallInfoFromContext returns the CallInfo of the request with the given
+// context.
+func CallInfoFromContext(ctx context.Context) (*CallInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info, ok
+}
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// doer returns the Doer dispatching the requests of the Client.
+func (c *Client) doer() Doer {
+	var d Doer = c.client
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		d = c.middleware[i](d)
+	}
+	return d
+}
+
+// withCallInfo returns ctx carrying the CallInfo of a call.
+func withCallInfo(
+	ctx context.Context,
+	endpoint string,
+	request any,
+	attempt int,
+) context.Context {
+	if in, ok := request.(inputer); ok {
+		request = in.input()
+	}
+	return context.WithValue(ctx, callInfoKey{}, &CallInfo{
+		Endpoint: endpoint,
+		Request:  request,
+		Attempt:  attempt,
+	})
+}
+
+func (p *imageRequestPayload) input() any     { return p.Payload }
+func (p *textRequestPayload) input() any      { return p.Payload }
+func (p *latexRequestPayload) input() any     { return p.Payload }
+func (p *documentRequestPayload) input() any  { return p.Payload }
+func (p *resultRequestPayload) input() any    { return &p.ResultRequest }
+func (p *postBatchRequestPayload) input() any { return p.Payload }
+func (p *getBatchPayload) input() any         { return p.PayloadID }
+func (p *requestStrokesPayload) input() any   { return p.Payload }
+func (p *appTokenPayload) input() any         { return p.Payload }
+func (p *ocrResultsPayload) input() any       { return p.Payload }
+func (p *usagePayload) input() any            { return p.Payload }
+func (p *uploadPayload) input() any           { return p.request }
@@ -0,0 +1,362 @@
+// Package otelmathpix instruments a mathpix.Client with OpenTelemetry
+// tracing and metrics.
+//
+// The instrumentation is a mathpix.Middleware:
+//
+//	client := mathpix.NewClient(
+//		apiKey,
+//		appID,
+//		mathpix.WithMiddleware(otelmathpix.Middleware()),
+//	)
+package otelmathpix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// instrumentationName is the name of the tracer and meter.
+	instrumentationName = "github.com/conneroisu/mathpix-go/otelmathpix"
+	// maxObservedBody is the largest JSON response body inspected for
+	// request ids, confidence values and errors. Larger bodies are passed
+	// through without being recorded.
+	maxObservedBody = 1 << 20
+	// maxCountedDocuments is the number of documents remembered as having
+	// their pages counted.
+	maxCountedDocuments = 4096
+)
+
+type (
+	// Option configures the instrumentation.
+	Option func(*config)
+	// config holds the instrumentation configuration.
+	config struct {
+		tracerProvider trace.TracerProvider
+		meterProvider  metric.MeterProvider
+	}
+	// instruments holds the tracer and metric instruments.
+	instruments struct {
+		tracer     trace.Tracer
+		requests   metric.Int64Counter
+		errors     metric.Int64Counter
+		pages      metric.Int64Counter
+		duration   metric.Float64Histogram
+		confidence metric.Float64Histogram
+		// counted are the documents whose pages were counted.
+		counted documents
+	}
+	// documents is a bounded set of document ids, forgetting the oldest
+	// ones first.
+	documents struct {
+		mu    sync.Mutex
+		ids   map[string]struct{}
+		order []string
+	}
+	// observed holds the response fields recorded by the instrumentation.
+	observed struct {
+		Confidence *float64                     `json:"confidence"`
+		Status     mathpix.ConversionStatusType `json:"status"`
+		NumPages   int64                        `json:"num_pages"`
+	}
+)
+
+// WithTracerProvider sets the TracerProvider used to create spans.
+// Defaults to the global TracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tracerProvider = tp }
+}
+
+// WithMeterProvider sets the MeterProvider used to create metrics.
+// Defaults to the global MeterProvider.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) { c.meterProvider = mp }
+}
+
+// Middleware returns a mathpix.Middleware that traces every request and
+// records metrics about it.
+//
+// Spans are named after the called endpoint (e.g. "v3/text") and carry
+// the request id and confidence of the response. The following metrics
+// are recorded:
+//
+//   - mathpix.requests: number of requests by endpoint
+//   - mathpix.errors: number of failed requests by endpoint, HTTP status
+//     code and error id
+//   - mathpix.pages: number of pages of completed documents, counted once
+//     per document the first time its status is polled as completed
+//   - mathpix.request.duration: request latency in seconds
+//   - mathpix.confidence: confidence of the recognition results
+func Middleware(opts ...Option) mathpix.Middleware {
+	cfg := config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	in := newInstruments(&cfg)
+	return func(next mathpix.Doer) mathpix.Doer {
+		return mathpix.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return in.do(next, req)
+		})
+	}
+}
+
+// newInstruments creates the instruments from the configuration.
+//
+// Instrument creation errors are reported to the global otel error handler
+// and leave a no-op instrument in place.
+func newInstruments(cfg *config) *instruments {
+	meter := cfg.meterProvider.Meter(instrumentationName)
+	in := &instruments{
+		tracer: cfg.tracerProvider.Tracer(instrumentationName),
+	}
+	var err error
+	in.requests, err = meter.Int64Counter(
+		"mathpix.requests",
+		metric.WithDescription("Number of requests sent to the Mathpix API."),
+	)
+	handle(err)
+	in.errors, err = meter.Int64Counter(
+		"mathpix.errors",
+		metric.WithDescription("Number of failed requests."),
+	)
+	handle(err)
+	in.pages, err = meter.Int64Counter(
+		"mathpix.pages",
+		metric.WithDescription("Number of pages of completed documents."),
+	)
+	handle(err)
+	in.duration, err = meter.Float64Histogram(
+		"mathpix.request.duration",
+		metric.WithDescription("Latency of requests to the Mathpix API."),
+		metric.WithUnit("s"),
+	)
+	handle(err)
+	in.confidence, err = meter.Float64Histogram(
+		"mathpix.confidence",
+		metric.WithDescription("Confidence of the recognition results."),
+	)
+	handle(err)
+	return in
+}
+
+// do sends req through next, recording a span and metrics.
+//
+// The span of a JSON response ends once its body is read to the end or
+// closed, so that the fields of the body can be recorded as the caller
+// reads it. Other responses, such as event streams and downloads, are
+// passed through untouched.
+func (in *instruments) do(
+	next mathpix.Doer,
+	req *http.Request,
+) (*http.Response, error) {
+	endpoint, attempt := req.URL.Path, 1
+	if info, ok := mathpix.CallInfoFromContext(req.Context()); ok {
+		endpoint, attempt = info.Endpoint, info.Attempt
+	}
+	endpointAttr := attribute.String("mathpix.endpoint", endpoint)
+	ctx, span := in.tracer.Start(
+		req.Context(),
+		endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			endpointAttr,
+			attribute.String("http.request.method", req.Method),
+			attribute.Int("mathpix.attempt", attempt),
+		),
+	)
+	start := time.Now()
+	res, err := next.Do(req.WithContext(ctx))
+	in.requests.Add(ctx, 1, metric.WithAttributes(endpointAttr))
+	in.duration.Record(
+		ctx,
+		time.Since(start).Seconds(),
+		metric.WithAttributes(endpointAttr),
+	)
+	if err != nil {
+		in.fail(ctx, span, err.Error(), endpointAttr)
+		span.End()
+		return res, err
+	}
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", res.StatusCode),
+	)
+	if !isJSON(res.Header.Get("Content-Type")) {
+		in.finish(ctx, span, endpointAttr, req, res, nil)
+		return res, nil
+	}
+	res.Body = &observer{
+		ReadCloser: res.Body,
+		done: func(body []byte) {
+			in.finish(ctx, span, endpointAttr, req, res, body)
+		},
+	}
+	return res, nil
+}
+
+// finish records the outcome of the response and ends its span.
+//
+// body is nil if the body of the response was not observed.
+func (in *instruments) finish(
+	ctx context.Context,
+	span trace.Span,
+	endpointAttr attribute.KeyValue,
+	req *http.Request,
+	res *http.Response,
+	body []byte,
+) {
+	defer span.End()
+	statusAttr := attribute.Int("http.response.status_code", res.StatusCode)
+	var (
+		requestID string
+		apiErr    *mathpix.APIError
+	)
+	if body != nil {
+		requestID, apiErr = mathpix.ParseError(body)
+	}
+	if requestID != "" {
+		span.SetAttributes(attribute.String("mathpix.request_id", requestID))
+	}
+	switch {
+	case apiErr != nil && apiErr.ID != "":
+		in.fail(ctx, span, apiErr.Error(), endpointAttr, statusAttr,
+			attribute.String("mathpix.error_id", apiErr.ID.String()),
+		)
+	case apiErr != nil:
+		in.fail(ctx, span, apiErr.Error(), endpointAttr, statusAttr)
+	case res.StatusCode >= http.StatusBadRequest:
+		in.fail(ctx, span, res.Status, endpointAttr, statusAttr)
+	}
+	var obs observed
+	if body == nil || json.Unmarshal(body, &obs) != nil {
+		return
+	}
+	if obs.Confidence != nil {
+		span.SetAttributes(
+			attribute.Float64("mathpix.confidence", *obs.Confidence),
+		)
+		in.confidence.Record(
+			ctx,
+			*obs.Confidence,
+			metric.WithAttributes(endpointAttr),
+		)
+	}
+	// Documents are polled until done, so only the first completed status
+	// of each document is counted.
+	if endpointAttr.Value.AsString() == "v3/status" &&
+		obs.Status == mathpix.ConversionStatusCompleted &&
+		obs.NumPages > 0 &&
+		in.counted.add(path.Base(req.URL.Path)) {
+		in.pages.Add(ctx, obs.NumPages, metric.WithAttributes(endpointAttr))
+	}
+}
+
+// add adds the document id to the set, reporting whether it was not in it
+// yet.
+func (d *documents) add(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.ids[id]; ok {
+		return false
+	}
+	if d.ids == nil {
+		d.ids = make(map[string]struct{})
+	}
+	if len(d.order) == maxCountedDocuments {
+		delete(d.ids, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.ids[id] = struct{}{}
+	d.order = append(d.order, id)
+	return true
+}
+
+// fail marks the span as failed and counts the error with the given
+// attributes.
+//
+// The mathpix.error_id attribute only ever holds a mathpix.ErrorID, HTTP
+// failures are told apart by the http.response.status_code attribute.
+func (in *instruments) fail(
+	ctx context.Context,
+	span trace.Span,
+	msg string,
+	attrs ...attribute.KeyValue,
+) {
+	span.SetStatus(codes.Error, msg)
+	span.SetAttributes(attrs...)
+	in.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// isJSON reports whether the content type is a JSON media type.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json"))
+}
+
+// observer is a response body keeping a copy of what the caller reads, so
+// that the fields of the body can be recorded once it is done.
+type observer struct {
+	io.ReadCloser
+	// done is called once with the body, or nil if it was not read to the
+	// end or is larger than maxObservedBody.
+	done     func(body []byte)
+	buf      bytes.Buffer
+	complete bool
+	once     sync.Once
+}
+
+// Read reads from the body, calling done once it returns an error.
+func (o *observer) Read(p []byte) (int, error) {
+	n, err := o.ReadCloser.Read(p)
+	if o.buf.Len() <= maxObservedBody {
+		o.buf.Write(p[:n])
+	}
+	if err != nil {
+		o.complete = err == io.EOF
+		o.finish()
+	}
+	return n, err
+}
+
+// Close closes the body and calls done if not already.
+func (o *observer) Close() error {
+	err := o.ReadCloser.Close()
+	o.finish()
+	return err
+}
+
+// finish calls done with the observed body.
+func (o *observer) finish() {
+	o.once.Do(func() {
+		if !o.complete || o.buf.Len() > maxObservedBody {
+			o.done(nil)
+			return
+		}
+		o.done(o.buf.Bytes())
+	})
+}
+
+// handle reports an instrument creation error to otel.
+func handle(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
@@ -0,0 +1,301 @@
+package otelmathpix_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+	"github.com/conneroisu/mathpix-go/otelmathpix"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+type (
+	// meterProvider records the measurements of the counters and
+	// histograms.
+	meterProvider struct {
+		noop.MeterProvider
+		meter *meter
+	}
+	meter struct {
+		noop.Meter
+		mu           sync.Mutex
+		measurements map[string][]measurement
+	}
+	// measurement is a value added to a counter or recorded by a histogram.
+	measurement struct {
+		value float64
+		attrs attribute.Set
+	}
+	counter struct {
+		noop.Int64Counter
+		meter *meter
+		name  string
+	}
+	histogram struct {
+		noop.Float64Histogram
+		meter *meter
+		name  string
+	}
+	// tracerProvider records the ended spans.
+	tracerProvider struct {
+		tracenoop.TracerProvider
+		mu    sync.Mutex
+		spans []*span
+	}
+	tracer struct {
+		tracenoop.Tracer
+		provider *tracerProvider
+	}
+	span struct {
+		tracenoop.Span
+		provider *tracerProvider
+		name     string
+		attrs    map[attribute.Key]attribute.Value
+	}
+)
+
+func newMeterProvider() *meterProvider {
+	return &meterProvider{
+		meter: &meter{measurements: make(map[string][]measurement)},
+	}
+}
+
+func (p *meterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+// get returns the measurements of the named instrument.
+func (p *meterProvider) get(name string) []measurement {
+	p.meter.mu.Lock()
+	defer p.meter.mu.Unlock()
+	return p.meter.measurements[name]
+}
+
+func (m *meter) Int64Counter(
+	name string,
+	_ ...metric.Int64CounterOption,
+) (metric.Int64Counter, error) {
+	return &counter{meter: m, name: name}, nil
+}
+
+func (m *meter) Float64Histogram(
+	name string,
+	_ ...metric.Float64HistogramOption,
+) (metric.Float64Histogram, error) {
+	return &histogram{meter: m, name: name}, nil
+}
+
+// record records a measurement of the named instrument.
+func (m *meter) record(name string, value float64, attrs attribute.Set) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.measurements[name] = append(
+		m.measurements[name],
+		measurement{value: value, attrs: attrs},
+	)
+}
+
+func (c *counter) Add(_ context.Context, n int64, opts ...metric.AddOption) {
+	c.meter.record(c.name, float64(n), metric.NewAddConfig(opts).Attributes())
+}
+
+func (h *histogram) Record(
+	_ context.Context,
+	v float64,
+	opts ...metric.RecordOption,
+) {
+	h.meter.record(h.name, v, metric.NewRecordConfig(opts).Attributes())
+}
+
+func (p *tracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &tracer{provider: p}
+}
+
+// ended returns the ended spans.
+func (p *tracerProvider) ended() []*span {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.spans
+}
+
+func (t *tracer) Start(
+	ctx context.Context,
+	name string,
+	opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	s := &span{
+		provider: t.provider,
+		name:     name,
+		attrs:    make(map[attribute.Key]attribute.Value),
+	}
+	cfg := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(cfg.Attributes()...)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (s *span) SetAttributes(attrs ...attribute.KeyValue) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *span) End(...trace.SpanEndOption) {
+	s.provider.mu.Lock()
+	defer s.provider.mu.Unlock()
+	s.provider.spans = append(s.provider.spans, s)
+}
+
+func TestStreamNotBuffered(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Handle("GET v3/pdf", http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			data, _ := json.Marshal(mathpix.PdfStreamEvent{
+				Text:           "page 1",
+				PageIdx:        1,
+				PdfSelectedLen: 2,
+			})
+			fmt.Fprintf(w, "id: 1\ndata: %s\n\n", data)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	client := srv.Client(mathpix.WithMiddleware(otelmathpix.Middleware()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	for page, err := range client.StreamPdf(ctx, "doc") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Text != "page 1" {
+			t.Errorf("got page %q, want %q", page.Text, "page 1")
+		}
+		break
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("first page received after %v", elapsed)
+	}
+}
+
+func TestErrorAttributes(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Fail("v3/text", mathpix.ErrImageDecode)
+	srv.Respond("v3/text", mathpixtest.Response{
+		StatusCode: http.StatusBadGateway,
+		Body:       "bad gateway",
+	})
+	mp := newMeterProvider()
+	client := srv.Client(mathpix.WithMiddleware(
+		otelmathpix.Middleware(otelmathpix.WithMeterProvider(mp)),
+	))
+
+	for range 2 {
+		_, err := client.Text(context.Background(), &mathpix.TextRequest{
+			SourceURL: "https://example.com/eq.png",
+		})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+
+	errs := mp.get("mathpix.errors")
+	if len(errs) != 2 {
+		t.Fatalf("counted %d errors, want 2", len(errs))
+	}
+	id, ok := errs[0].attrs.Value("mathpix.error_id")
+	if !ok || id.AsString() != string(mathpix.ErrImageDecode) {
+		t.Errorf("got error id %v, want %q", id.AsString(), mathpix.ErrImageDecode)
+	}
+	if id, ok = errs[1].attrs.Value("mathpix.error_id"); ok {
+		t.Errorf("got error id %q for a status error", id.AsString())
+	}
+	status, _ := errs[1].attrs.Value("http.response.status_code")
+	if status.AsInt64() != http.StatusBadGateway {
+		t.Errorf("got status %d, want %d", status.AsInt64(), http.StatusBadGateway)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	srv := mathpixtest.NewServer(mathpixtest.WithImageResponse(
+		mathpix.ImageResponse{Text: "x", Confidence: 0.75},
+	))
+	defer srv.Close()
+	tp, mp := &tracerProvider{}, newMeterProvider()
+	client := srv.Client(mathpix.WithMiddleware(otelmathpix.Middleware(
+		otelmathpix.WithTracerProvider(tp),
+		otelmathpix.WithMeterProvider(mp),
+	)))
+
+	if _, err := client.Text(context.Background(), &mathpix.TextRequest{
+		SourceURL: "https://example.com/eq.png",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tp.ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended %d spans, want 1", len(spans))
+	}
+	if spans[0].name != "v3/text" {
+		t.Errorf("got span %q, want %q", spans[0].name, "v3/text")
+	}
+	for key, want := range map[attribute.Key]attribute.Value{
+		"mathpix.endpoint":          attribute.StringValue("v3/text"),
+		"http.request.method":       attribute.StringValue(http.MethodPost),
+		"http.response.status_code": attribute.IntValue(http.StatusOK),
+		"mathpix.confidence":        attribute.Float64Value(0.75),
+	} {
+		if got := spans[0].attrs[key]; got != want {
+			t.Errorf("got %s %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if _, ok := spans[0].attrs["mathpix.request_id"]; !ok {
+		t.Error("request id not recorded")
+	}
+	confidence := mp.get("mathpix.confidence")
+	if len(confidence) != 1 || confidence[0].value != 0.75 {
+		t.Errorf("got confidence %v, want 0.75", confidence)
+	}
+}
+
+func TestPagesCountedOnce(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.AddDocument("doc", mathpixtest.Document{
+		Pages: []string{"# One", "# Two", "# Three"},
+		Polls: 1,
+	})
+	mp := newMeterProvider()
+	client := srv.Client(mathpix.WithMiddleware(
+		otelmathpix.Middleware(otelmathpix.WithMeterProvider(mp)),
+	))
+
+	// The document is processing on the first poll and completed on the
+	// following ones.
+	for range 4 {
+		if _, err := client.PdfResult(context.Background(), &mathpix.ResultRequest{
+			PDFID: "doc",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages := mp.get("mathpix.pages")
+	if len(pages) != 1 || pages[0].value != 3 {
+		t.Errorf("got pages %v, want 3 counted once", pages)
+	}
+}
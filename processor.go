@@ -0,0 +1,244 @@
+package mathpix
+
+import (
+	"context"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// defaultWorkers is the number of workers of a BatchProcessor without
+	// Workers set.
+	defaultWorkers = 4
+	// orderedWindow is the number of inputs per worker an ordered
+	// BatchProcessor may start ahead of the next result to yield.
+	orderedWindow = 4
+)
+
+type (
+	// BatchProcessor OCRs many images with Client.Image using a bounded
+	// pool of workers.
+	//
+	// The zero value is not usable, Client must be set. Its fields must not
+	// be changed while Process is running.
+	BatchProcessor struct {
+		// Client sends the image requests.
+		Client *Client
+		// Workers is the number of images processed concurrently.
+		// Defaults to 4.
+		Workers int
+		// Ordered makes Process yield the results in the order of the
+		// inputs instead of as they complete. At most 4 inputs per worker
+		// are started ahead of the next result to yield, so a slow image
+		// holds back the following ones instead of buffering their results.
+		Ordered bool
+		// Limiter limits the rate of the requests of the processor, in
+		// addition to the rate limiter of the Client.
+		Limiter *RateLimiter
+		// Retry retries the images that failed with a retryable error,
+		// replacing the RetryPolicy of the Client so that attempts are not
+		// multiplied. Defaults to the RetryPolicy of the Client. As images
+		// are sent with POST, the policy must set RetryNonIdempotent. Images
+		// read from a Reader are never retried.
+		Retry *RetryPolicy
+		// OnProgress is called with the current stats after every result.
+		OnProgress func(BatchStats)
+
+		started   atomic.Int64
+		succeeded atomic.Int64
+		failed    atomic.Int64
+		retries   atomic.Int64
+	}
+	// BatchInput is an image processed by a BatchProcessor.
+	BatchInput struct {
+		// Key identifies the image in its result.
+		Key string
+		// Request is the image request.
+		Request *ImageRequest
+	}
+	// BatchResult is the result of a BatchInput.
+	BatchResult struct {
+		// Key is the key of the input.
+		Key string
+		// Index is the position of the input in the processed sequence.
+		Index int
+		// Response is the response of the last attempt, if any.
+		Response *ImageResponse
+		// Err is the error of the last attempt.
+		Err error
+		// Attempts is the number of attempts made.
+		Attempts int
+	}
+	// BatchStats counts the images handled by a BatchProcessor across all
+	// calls to Process.
+	BatchStats struct {
+		// Started is the number of images whose processing started.
+		Started int64
+		// Succeeded is the number of images processed without error.
+		Succeeded int64
+		// Failed is the number of images that failed after all attempts.
+		Failed int64
+		// Retries is the number of retried attempts.
+		Retries int64
+	}
+	// batchJob is an input queued for the workers.
+	batchJob struct {
+		index int
+		input BatchInput
+	}
+)
+
+// Process returns an iterator processing the inputs and yielding their
+// results.
+//
+// Inputs are read as workers become available, so inputs may be an
+// unbounded sequence. When ctx is done, no new input is started and the
+// iteration ends once the images being processed return. Stopping the
+// iteration early cancels the images being processed.
+func (p *BatchProcessor) Process(
+	ctx context.Context,
+	inputs iter.Seq[BatchInput],
+) iter.Seq[*BatchResult] {
+	return func(yield func(*BatchResult) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		workers := p.Workers
+		if workers <= 0 {
+			workers = defaultWorkers
+		}
+		jobs := make(chan batchJob)
+		results := make(chan *BatchResult)
+		// window holds a slot for every started input whose result has not
+		// been yielded in order yet.
+		var window chan struct{}
+		if p.Ordered {
+			window = make(chan struct{}, workers*orderedWindow)
+		}
+		go func() {
+			defer close(jobs)
+			index := 0
+			for input := range inputs {
+				if window != nil {
+					select {
+					case window <- struct{}{}:
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case jobs <- batchJob{index: index, input: input}:
+					index++
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for job := range jobs {
+					if ctx.Err() != nil {
+						continue
+					}
+					results <- p.process(ctx, job)
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		// Workers are released by draining their results once cancelled.
+		defer func() {
+			cancel()
+			for range results {
+			}
+		}()
+		var (
+			next    int
+			pending = make(map[int]*BatchResult)
+		)
+		for res := range results {
+			if p.OnProgress != nil {
+				p.OnProgress(p.Stats())
+			}
+			if !p.Ordered {
+				if !yield(res) {
+					return
+				}
+				continue
+			}
+			pending[res.Index] = res
+			for pending[next] != nil {
+				res, next = pending[next], next+1
+				delete(pending, res.Index)
+				<-window
+				if !yield(res) {
+					return
+				}
+			}
+		}
+		// Inputs skipped after cancellation leave gaps in the order.
+		for ; len(pending) > 0; next++ {
+			if res, ok := pending[next]; ok {
+				delete(pending, next)
+				if !yield(res) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stats returns the current stats of the processor.
+func (p *BatchProcessor) Stats() BatchStats {
+	return BatchStats{
+		Started:   p.started.Load(),
+		Succeeded: p.succeeded.Load(),
+		Failed:    p.failed.Load(),
+		Retries:   p.retries.Load(),
+	}
+}
+
+// process processes a single job, retrying it according to the retry
+// policy of the processor.
+//
+// The Client makes a single attempt per call, so that only the processor
+// retries and counts the attempts. The status code and headers of failed
+// responses, such as a Retry-After, are taken from their *ResponseError.
+func (p *BatchProcessor) process(ctx context.Context, job batchJob) *BatchResult {
+	p.started.Add(1)
+	res := &BatchResult{Key: job.input.Key, Index: job.index}
+	policy := p.Retry
+	if policy == nil {
+		policy = p.Client.retry
+	}
+	attempts := policy.attempts(imagesEndpoint.method)
+	if job.input.Request.Reader != nil {
+		attempts = 1
+	}
+	callCtx := withoutRetries(ctx)
+	for {
+		res.Attempts++
+		res.Err = p.Limiter.Wait(ctx, imagesEndpoint.name)
+		if res.Err == nil {
+			res.Response, res.Err = p.Client.Image(callCtx, job.input.Request)
+		}
+		failed := failedResponse(res.Err)
+		if res.Attempts >= attempts || !policy.retryable(failed, res.Err) {
+			break
+		}
+		if sleep(ctx, policy.backoff(res.Attempts, failed)) != nil {
+			break
+		}
+		p.retries.Add(1)
+	}
+	if res.Err != nil {
+		p.failed.Add(1)
+	} else {
+		p.succeeded.Add(1)
+	}
+	return res
+}
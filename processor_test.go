@@ -0,0 +1,236 @@
+package mathpix_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+// images returns a sequence of n image inputs, or an unbounded one if n is
+// negative.
+func images(n int) iter.Seq[mathpix.BatchInput] {
+	return func(yield func(mathpix.BatchInput) bool) {
+		for i := 0; n < 0 || i < n; i++ {
+			if !yield(mathpix.BatchInput{
+				Key: fmt.Sprint(i),
+				Request: &mathpix.ImageRequest{
+					SourceURL: fmt.Sprintf("https://example.com/%d.png", i),
+				},
+			}) {
+				return
+			}
+		}
+	}
+}
+
+func TestBatchProcessorOrdered(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	p := &mathpix.BatchProcessor{
+		Client:  srv.Client(),
+		Workers: 4,
+		Ordered: true,
+	}
+
+	next := 0
+	for res := range p.Process(context.Background(), images(50)) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if res.Index != next || res.Key != fmt.Sprint(next) {
+			t.Fatalf("got result %d (%q), want %d", res.Index, res.Key, next)
+		}
+		next++
+	}
+	if next != 50 {
+		t.Errorf("got %d results, want 50", next)
+	}
+	stats := p.Stats()
+	if stats.Started != 50 || stats.Succeeded != 50 || stats.Failed != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestBatchProcessorOrderedWindow(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	release := make(chan struct{})
+	srv.Handle("v3/image", http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			// The first image is held back until released.
+			if strings.Contains(string(body), "/0.png") {
+				<-release
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"text":"x"}`)
+		},
+	))
+	p := &mathpix.BatchProcessor{
+		Client:  srv.Client(),
+		Workers: 2,
+		Ordered: true,
+	}
+
+	done := make(chan int)
+	go func() {
+		n := 0
+		for res := range p.Process(context.Background(), images(100)) {
+			if res.Err != nil {
+				t.Error(res.Err)
+			}
+			n++
+		}
+		done <- n
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if started := p.Stats().Started; started != 2*4 {
+		t.Errorf("started %d images behind the first one, want 8", started)
+	}
+	close(release)
+	if n := <-done; n != 100 {
+		t.Errorf("got %d results, want 100", n)
+	}
+}
+
+func TestBatchProcessorRetry(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Fail("v3/image", mathpix.ErrSysException, mathpix.ErrSysException)
+	policy := &mathpix.RetryPolicy{MaxAttempts: 4, RetryNonIdempotent: true}
+	p := &mathpix.BatchProcessor{
+		Client: srv.Client(mathpix.WithRetryPolicy(policy)),
+		Retry:  policy,
+	}
+
+	for res := range p.Process(context.Background(), images(1)) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if res.Attempts != 3 {
+			t.Errorf("made %d attempts, want 3", res.Attempts)
+		}
+	}
+	if n := len(srv.RequestsTo("v3/image")); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+	if stats := p.Stats(); stats.Retries != 2 {
+		t.Errorf("counted %d retries, want 2", stats.Retries)
+	}
+}
+
+func TestBatchProcessorRetryAfter(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("v3/image", mathpixtest.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"1"}},
+		Body:       `{"error":"too many requests"}`,
+	})
+	p := &mathpix.BatchProcessor{
+		Client: srv.Client(),
+		Retry: &mathpix.RetryPolicy{
+			MaxAttempts:        2,
+			BaseDelay:          time.Millisecond,
+			RetryNonIdempotent: true,
+		},
+	}
+
+	start := time.Now()
+	for res := range p.Process(context.Background(), images(1)) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the 1s Retry-After", elapsed)
+	}
+	if n := len(srv.RequestsTo("v3/image")); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestBatchProcessorLocalError(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	p := &mathpix.BatchProcessor{
+		Client: srv.Client(),
+		Retry:  &mathpix.RetryPolicy{MaxAttempts: 4, RetryNonIdempotent: true},
+	}
+	input := mathpix.BatchInput{
+		Key: "missing",
+		Request: &mathpix.ImageRequest{
+			File: filepath.Join(t.TempDir(), "missing.png"),
+		},
+	}
+
+	for res := range p.Process(context.Background(), func(yield func(mathpix.BatchInput) bool) {
+		yield(input)
+	}) {
+		if res.Err == nil {
+			t.Fatal("expected an error")
+		}
+		if res.Attempts != 1 {
+			t.Errorf("made %d attempts, want 1", res.Attempts)
+		}
+	}
+	if stats := p.Stats(); stats.Failed != 1 || stats.Retries != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestBatchProcessorCancel(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	p := &mathpix.BatchProcessor{Client: srv.Client(), Workers: 4}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range p.Process(ctx, images(-1)) {
+			if n++; n == 10 {
+				cancel()
+			}
+		}
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		// Images in flight when cancelled still yield their results.
+		if n < 10 || n > 10+4 {
+			t.Errorf("got %d results, want 10 to 14", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("processing did not stop after cancellation")
+	}
+}
+
+func TestBatchProcessorBreak(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	p := &mathpix.BatchProcessor{Client: srv.Client(), Workers: 4, Ordered: true}
+
+	n := 0
+	for res := range p.Process(context.Background(), images(-1)) {
+		if res.Index != n {
+			t.Fatalf("got result %d, want %d", res.Index, n)
+		}
+		if n++; n == 5 {
+			break
+		}
+	}
+	if started := p.Stats().Started; started > 5+4+4 {
+		t.Errorf("started %d images after stopping", started)
+	}
+}
@@ -0,0 +1,147 @@
+package mathpix
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// RateLimit describes a token bucket limit.
+	RateLimit struct {
+		// Rate is the number of requests allowed per second.
+		// A zero or negative rate means no limit.
+		Rate float64
+		// Burst is the maximum number of requests that may be sent at once.
+		// Defaults to 1.
+		Burst int
+	}
+	// RateLimiter is a client-side token bucket rate limiter with separate
+	// buckets per endpoint.
+	//
+	// It is safe for concurrent use.
+	RateLimiter struct {
+		mu       sync.Mutex
+		fallback RateLimit
+		limits   map[string]RateLimit
+		buckets  map[string]*bucket
+		// now returns the current time, replaced in tests.
+		now func() time.Time
+	}
+	// bucket is a single token bucket.
+	bucket struct {
+		limit  RateLimit
+		tokens float64
+		last   time.Time
+	}
+)
+
+// NewRateLimiter creates a new RateLimiter.
+//
+// perEndpoint maps endpoint names (e.g. "v3/image", "v3/pdf") to their own
+// limits. Endpoints not present in the map use fallback.
+func NewRateLimiter(
+	fallback RateLimit,
+	perEndpoint map[string]RateLimit,
+) *RateLimiter {
+	return &RateLimiter{
+		fallback: fallback,
+		limits:   perEndpoint,
+		buckets:  make(map[string]*bucket),
+		now:      time.Now,
+	}
+}
+
+// WithRateLimit sets the rate limiter applied before every request the
+// Client sends.
+func WithRateLimit(limiter *RateLimiter) ClientOption {
+	return func(c *Client) { c.limiter = limiter }
+}
+
+// Wait blocks until a request to the endpoint is allowed or the context is
+// done.
+func (l *RateLimiter) Wait(ctx context.Context, endpoint string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	b := l.bucket(endpoint)
+	d := b.reserve(l.now())
+	l.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, d); err != nil {
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Delay returns how long a request to the endpoint would currently have to
+// wait before being sent.
+func (l *RateLimiter) Delay(endpoint string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(endpoint)
+	b.refill(l.now())
+	return b.delay()
+}
+
+// bucket returns the bucket for the endpoint, creating it if needed.
+//
+// l.mu must be held.
+func (l *RateLimiter) bucket(endpoint string) *bucket {
+	if b, ok := l.buckets[endpoint]; ok {
+		return b
+	}
+	limit, ok := l.limits[endpoint]
+	if !ok {
+		limit = l.fallback
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	b := &bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   l.now(),
+	}
+	l.buckets[endpoint] = b
+	return b
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (b *bucket) refill(now time.Time) {
+	if b.limit.Rate <= 0 {
+		return
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = min(b.tokens+elapsed*b.limit.Rate, float64(b.limit.Burst))
+}
+
+// delay returns the time until a token is available.
+func (b *bucket) delay() time.Duration {
+	if b.limit.Rate <= 0 || b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// reserve takes a token and returns how long the caller must wait before
+// using it.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	if b.limit.Rate <= 0 {
+		return 0
+	}
+	b.refill(now)
+	d := b.delay()
+	b.tokens--
+	return d
+}
@@ -0,0 +1,82 @@
+package mathpix_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+)
+
+// fakeClock is a clock advanced by hand.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newLimiter returns a RateLimiter of one request per second with a burst
+// of two, driven by the returned clock.
+func newLimiter() (*mathpix.RateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := mathpix.NewRateLimiter(mathpix.RateLimit{Rate: 1, Burst: 2}, nil)
+	l.SetClock(clock.Now)
+	return l, clock
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	ctx := context.Background()
+	l, clock := newLimiter()
+	// wait takes a token that must be available without waiting.
+	wait := func() {
+		t.Helper()
+		if d := l.Delay("v3/image"); d != 0 {
+			t.Fatalf("got delay %v before waiting, want 0", d)
+		}
+		if err := l.Wait(ctx, "v3/image"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delay := func(want time.Duration) {
+		t.Helper()
+		if d := l.Delay("v3/image"); d != want {
+			t.Errorf("got delay %v, want %v", d, want)
+		}
+	}
+
+	wait()
+	wait()
+	delay(time.Second)
+	clock.advance(500 * time.Millisecond)
+	delay(500 * time.Millisecond)
+	// The bucket holds at most Burst tokens.
+	clock.advance(time.Hour)
+	wait()
+	wait()
+	delay(time.Second)
+	if d := l.Delay("v3/pdf"); d != 0 {
+		t.Errorf("got delay %v for another endpoint, want 0", d)
+	}
+}
+
+func TestRateLimiterCancelRefund(t *testing.T) {
+	l, _ := newLimiter()
+	for range 2 {
+		if err := l.Wait(context.Background(), "v3/image"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for range 3 {
+		if err := l.Wait(ctx, "v3/image"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+	}
+	// The tokens taken by the cancelled waits are given back.
+	if d := l.Delay("v3/image"); d != time.Second {
+		t.Errorf("got delay %v, want %v", d, time.Second)
+	}
+}
@@ -0,0 +1,205 @@
+package mathpix
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how the Client retries failed requests.
+//
+// A nil policy (the default) makes a single attempt per call.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry.
+	// Each following retry doubles the delay up to MaxDelay.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts.
+	MaxDelay time.Duration
+	// Jitter is the fraction (0-1) of each delay that is randomized.
+	Jitter float64
+	// RetryNonIdempotent allows retrying non-idempotent (POST) requests.
+	RetryNonIdempotent bool
+	// Retryable decides if a failed attempt should be retried.
+	// statusCode is zero when no response was received.
+	// If nil, DefaultRetryable is used.
+	Retryable func(statusCode int, id ErrorID, err error) bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with sensible defaults.
+//
+// Only idempotent requests are retried.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.5,
+		Retryable:   DefaultRetryable,
+	}
+}
+
+// singleAttemptKey is the context key marking calls that are not retried.
+type singleAttemptKey struct{}
+
+// WithRetryPolicy sets the retry policy for the Client.
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) { c.retry = policy }
+}
+
+// withoutRetries returns a context making the calls it is used for make a
+// single attempt, for callers retrying them on their own.
+func withoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, singleAttemptKey{}, true)
+}
+
+// DefaultRetryable reports whether a failed attempt is transient.
+//
+// Network errors, HTTP 429 and 5xx responses, and the http_max_requests and
+// sys_exception error ids are considered transient. Other errors without a
+// status code, such as invalid inputs or unreadable files, are not.
+func DefaultRetryable(statusCode int, id ErrorID, err error) bool {
+	switch id {
+	case ErrHTTPMaxRequests, ErrSysException:
+		return true
+	}
+	if statusCode == http.StatusTooManyRequests ||
+		statusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return statusCode == 0 && isNetworkError(err)
+}
+
+// isNetworkError reports whether err is a connection failure, as opposed to
+// a local failure or a cancellation.
+//
+// The *url.Error returned by http.Client is unwrapped first, since it
+// also wraps failures to read the request body.
+func isNetworkError(err error) bool {
+	if err == nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var (
+		opErr  *net.OpError
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+	return errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr) ||
+		errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// attempts returns the maximum number of attempts for the given method.
+func (p *RetryPolicy) attempts(method string) int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	if !p.RetryNonIdempotent && !isIdempotent(method) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// retryable reports whether the attempt that produced res and err should be
+// retried.
+func (p *RetryPolicy) retryable(res *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	status, id := errorDetails(err)
+	if res != nil {
+		status = res.StatusCode
+	}
+	if p.Retryable == nil {
+		return DefaultRetryable(status, id, err)
+	}
+	return p.Retryable(status, id, err)
+}
+
+// backoff returns the delay before the given retry attempt (starting at 1).
+//
+// A Retry-After header on res takes precedence over the computed delay.
+func (p *RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// failedResponse returns the status code and headers of the response that
+// failed with err, or nil if err is not a *ResponseError.
+func failedResponse(err error) *http.Response {
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		return nil
+	}
+	return &http.Response{
+		StatusCode: respErr.StatusCode,
+		Header:     respErr.Header,
+	}
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or HTTP date form.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// isIdempotent reports whether the HTTP method is idempotent.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
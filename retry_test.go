@@ -0,0 +1,80 @@
+package mathpix_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("x"), false},
+		{"conversion pending", mathpix.ErrConversionPending, false},
+		{"canceled", context.Canceled, false},
+		{"max requests", mathpix.ErrHTTPMaxRequests, true},
+		{"sys exception", &mathpix.APIError{ID: mathpix.ErrSysException}, true},
+		{"input error", &mathpix.APIError{ID: mathpix.ErrImageDecode}, false},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"connection refused", &url.Error{
+			Op:  "Post",
+			URL: "https://api.mathpix.com/v3/image",
+			Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+		}, true},
+		{"unreadable body", &url.Error{
+			Op:  "Post",
+			URL: "https://api.mathpix.com/v3/image",
+			Err: fmt.Errorf("upload: %w", syscall.ENOENT),
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mathpix.IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryMissingUpload(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	attempts := 0
+	client := srv.Client(
+		mathpix.WithRetryPolicy(&mathpix.RetryPolicy{
+			MaxAttempts:        4,
+			RetryNonIdempotent: true,
+		}),
+		mathpix.WithMiddleware(func(next mathpix.Doer) mathpix.Doer {
+			return mathpix.DoerFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return next.Do(req)
+			})
+		}),
+	)
+
+	_, err := client.Image(context.Background(), &mathpix.ImageRequest{
+		File: filepath.Join(t.TempDir(), "missing.png"),
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("made %d attempts, want 1", attempts)
+	}
+}
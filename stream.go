@@ -0,0 +1,188 @@
+package mathpix
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStreamReconnects is the number of times in a row StreamPdf reconnects
+// to a stream that was interrupted without receiving a page.
+const maxStreamReconnects = 5
+
+type (
+	// PdfStreamEvent is a page result sent over the streaming endpoint of a
+	// document processed with RequestDocument.Streaming set.
+	PdfStreamEvent struct {
+		// ID is the server-sent event id
+		ID string `json:"-"`
+		// Text contains the page content in Mathpix Markdown format
+		Text string `json:"text"`
+		// PageIdx is the 1-based index of the page
+		PageIdx int `json:"page_idx"`
+		// PdfSelectedLen is the number of pages selected for processing
+		PdfSelectedLen int `json:"pdf_selected_len"`
+	}
+	// sseEvent is a raw server-sent event.
+	sseEvent struct {
+		id    string
+		data  string
+		retry time.Duration
+	}
+)
+
+// StreamPdf returns an iterator over the page results of a document as
+// they are processed.
+//
+// Interrupted streams are resumed using the id of the last received event.
+// Iteration stops after the last page, after the first unrecoverable error,
+// or when the context is cancelled.
+func (c *Client) StreamPdf(
+	ctx context.Context,
+	pdfID string,
+) iter.Seq2[*PdfStreamEvent, error] {
+	return func(yield func(*PdfStreamEvent, error) bool) {
+		var (
+			lastID     string
+			delay      = time.Second
+			reconnects int
+		)
+		for {
+			header := http.Header{"Accept": {"text/event-stream"}}
+			if lastID != "" {
+				header.Set("Last-Event-ID", lastID)
+			}
+			res, err := open(
+				ctx,
+				c,
+				http.MethodGet,
+				documentsEndpoint.name,
+				pdfID+"/stream",
+				header,
+			)
+			if err == nil {
+				err = streamError(res)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					yield(nil, err)
+				}
+				return
+			}
+			done := false
+			for ev, err := range readEvents(res.Body) {
+				if err != nil {
+					break
+				}
+				if ev.retry > 0 {
+					delay = ev.retry
+				}
+				if ev.id != "" {
+					lastID = ev.id
+				}
+				if ev.data == "" {
+					continue
+				}
+				page := PdfStreamEvent{ID: ev.id}
+				if err = json.Unmarshal([]byte(ev.data), &page); err != nil {
+					res.Body.Close()
+					yield(nil, err)
+					return
+				}
+				reconnects = 0
+				if !yield(&page, nil) {
+					res.Body.Close()
+					return
+				}
+				if page.PdfSelectedLen > 0 &&
+					page.PageIdx >= page.PdfSelectedLen {
+					done = true
+					break
+				}
+			}
+			res.Body.Close()
+			if done || ctx.Err() != nil {
+				return
+			}
+			if reconnects >= maxStreamReconnects {
+				yield(nil, errors.New("mathpix: pdf stream interrupted"))
+				return
+			}
+			reconnects++
+			if sleep(ctx, delay) != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamError returns the error carried by a successful response that is
+// not an event stream, such as an unknown pdf id, and closes its body.
+func streamError(res *http.Response) error {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return nil
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err = responseError(documentsEndpoint.name, res, body); err != nil {
+		return err
+	}
+	return errors.New("mathpix: unexpected pdf stream content type " + mediaType)
+}
+
+// readEvents parses server-sent events from r.
+//
+// The iterator yields io.ErrUnexpectedEOF if the stream ends in the middle
+// of an event.
+func readEvents(r io.Reader) iter.Seq2[sseEvent, error] {
+	return func(yield func(sseEvent, error) bool) {
+		var (
+			br   = bufio.NewReader(r)
+			ev   sseEvent
+			data []string
+		)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				if errors.Is(err, io.EOF) && line == "" && len(data) == 0 {
+					return
+				}
+				yield(ev, io.ErrUnexpectedEOF)
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				ev.data = strings.Join(data, "\n")
+				if !yield(ev, nil) {
+					return
+				}
+				ev, data = sseEvent{}, nil
+				continue
+			}
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				ev.id = value
+			case "data":
+				data = append(data, value)
+			case "retry":
+				if ms, err := strconv.Atoi(value); err == nil {
+					ev.retry = time.Duration(ms) * time.Millisecond
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package mathpix_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestStreamPdf(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.AddDocument("doc", mathpixtest.Document{
+		Pages: []string{"page 1", "page 2", "page 3"},
+	})
+
+	var pages []string
+	for page, err := range srv.Client().StreamPdf(context.Background(), "doc") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page.Text)
+	}
+	if want := []string{"page 1", "page 2", "page 3"}; fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("got pages %q, want %q", pages, want)
+	}
+}
+
+func TestStreamPdfResume(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	var lastIDs []string
+	srv.Handle("GET v3/pdf", http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+			w.Header().Set("Content-Type", "text/event-stream")
+			// The first connection is interrupted after the first page.
+			page := len(lastIDs)
+			data, _ := json.Marshal(mathpix.PdfStreamEvent{
+				Text:           fmt.Sprintf("page %d", page),
+				PageIdx:        page,
+				PdfSelectedLen: 2,
+			})
+			fmt.Fprintf(w, "retry: 1\nid: %d\ndata: %s\n\n", page, data)
+		},
+	))
+
+	var pages []string
+	for page, err := range srv.Client().StreamPdf(context.Background(), "doc") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page.Text)
+	}
+	if want := []string{"page 1", "page 2"}; fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("got pages %q, want %q", pages, want)
+	}
+	if want := []string{"", "1"}; fmt.Sprint(lastIDs) != fmt.Sprint(want) {
+		t.Errorf("got Last-Event-IDs %q, want %q", lastIDs, want)
+	}
+}
+
+func TestStreamPdfUnknownID(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+
+	var errs []error
+	for _, err := range srv.Client().StreamPdf(context.Background(), "missing") {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], mathpix.ErrPDFUnknownID) {
+		t.Errorf("got errors %v, want %v", errs, mathpix.ErrPDFUnknownID)
+	}
+}
@@ -0,0 +1,106 @@
+package mathpix
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before its expiry an app token is
+// refreshed.
+const tokenRefreshMargin = 10 * time.Second
+
+type (
+	// TokenSource provides app tokens used to authenticate requests with
+	// the app_token header instead of app_key and app_id.
+	TokenSource interface {
+		// Token returns a valid app token.
+		Token(ctx context.Context) (string, error)
+	}
+	// StaticToken is a TokenSource that always returns the same token.
+	StaticToken string
+	// AppTokenSource is a TokenSource that mints app tokens with a Client
+	// authenticated by app key and refreshes them before they expire.
+	//
+	// It is safe for concurrent use.
+	AppTokenSource struct {
+		client  *Client
+		request AppTokenRequest
+		mu      sync.Mutex
+		current *AppTokenResponse
+	}
+	// tokenCredentials adapts a TokenSource to a CredentialsProvider.
+	tokenCredentials struct {
+		source TokenSource
+	}
+)
+
+// WithTokenSource makes the Client authenticate with app tokens from source
+// instead of its app key and app id.
+func WithTokenSource(source TokenSource) ClientOption {
+	return WithCredentials(tokenCredentials{source: source})
+}
+
+// NewClientFromToken creates a new Client that authenticates with the given
+// app token.
+//
+// The client never sees the app key, which makes it suitable for code
+// running on untrusted devices. Once the token expires, requests fail with
+// ErrHTTPUnauthorized.
+func NewClientFromToken(token string, opts ...ClientOption) *Client {
+	return NewClient("", "", append(opts, WithTokenSource(StaticToken(token)))...)
+}
+
+// Token returns the static token.
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// NewAppTokenSource creates a new AppTokenSource that mints tokens with
+// client using the given request.
+func NewAppTokenSource(
+	client *Client,
+	request *AppTokenRequest,
+) *AppTokenSource {
+	return &AppTokenSource{client: client, request: *request}
+}
+
+// Token returns the current app token, minting a new one if it is missing
+// or about to expire.
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	res, err := s.Response(ctx)
+	if err != nil {
+		return "", err
+	}
+	return res.AppToken, nil
+}
+
+// Response returns the current app token response, minting a new one if it
+// is missing or about to expire.
+func (s *AppTokenSource) Response(
+	ctx context.Context,
+) (*AppTokenResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		expiresAt := time.Unix(s.current.AppTokenExpiresAt, 0)
+		if time.Until(expiresAt) > tokenRefreshMargin {
+			return s.current, nil
+		}
+	}
+	res, err := s.client.NewClientToken(ctx, &s.request)
+	if err != nil {
+		return nil, err
+	}
+	s.current = res
+	return res, nil
+}
+
+// Credentials returns credentials carrying an app token from the source.
+func (t tokenCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	token, err := t.source.Token(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{AppToken: token}, nil
+}
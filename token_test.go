@@ -0,0 +1,75 @@
+package mathpix_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestAppTokenSourceRefresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires int64
+		mints   int
+	}{
+		{"valid", 300, 1},
+		// Tokens expiring within the refresh margin are minted again.
+		{"expiring", 5, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := mathpixtest.NewServer()
+			defer srv.Close()
+			source := mathpix.NewAppTokenSource(
+				srv.Client(),
+				&mathpix.AppTokenRequest{Expires: tt.expires},
+			)
+
+			tokens := make(map[string]bool)
+			for range 3 {
+				token, err := source.Token(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens[token] = true
+			}
+			if n := len(srv.RequestsTo("POST v3/app-tokens")); n != tt.mints {
+				t.Errorf("minted %d tokens, want %d", n, tt.mints)
+			}
+			if len(tokens) != tt.mints {
+				t.Errorf("got %d distinct tokens, want %d", len(tokens), tt.mints)
+			}
+		})
+	}
+}
+
+func TestNewClientFromToken(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	token, err := mathpix.NewAppTokenSource(
+		srv.Client(),
+		&mathpix.AppTokenRequest{},
+	).Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := mathpix.NewClientFromToken(token, mathpix.WithBaseURL(srv.URL))
+
+	if _, err = client.Text(context.Background(), &mathpix.TextRequest{
+		SourceURL: "https://example.com/eq.png",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	header := srv.RequestsTo("v3/text")[0].Header
+	if got := header.Get("app_token"); got != token {
+		t.Errorf("sent app_token %q, want %q", got, token)
+	}
+	for _, key := range []string{"app_key", "app_id"} {
+		if _, ok := header[http.CanonicalHeaderKey(key)]; ok {
+			t.Errorf("sent %s with an app token", key)
+		}
+	}
+}
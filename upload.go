@@ -0,0 +1,213 @@
+package mathpix
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+)
+
+// Upload is a file sent as a part of a multipart/form-data request.
+//
+// Uploads created from a path are reopened on every attempt and can be
+// retried, uploads created from a reader can only be sent once.
+type Upload struct {
+	name string
+	path string
+	r    io.Reader
+}
+
+// UploadFile creates an Upload that streams the file at path.
+func UploadFile(path string) *Upload {
+	return &Upload{name: filepath.Base(path), path: path}
+}
+
+// UploadReader creates an Upload that streams r under the given filename.
+//
+// The filename extension is used by Mathpix to detect the file format.
+func UploadReader(filename string, r io.Reader) *Upload {
+	return &Upload{name: filename, r: r}
+}
+
+// Filename returns the filename of the upload.
+func (u *Upload) Filename() string {
+	return u.name
+}
+
+// MarshalFile opens the upload stream.
+//
+// Files opened from a path are closed once they are read to the end or
+// fail, but the stream should still be closed when not fully read.
+func (u *Upload) MarshalFile() (io.ReadCloser, error) {
+	if u.path != "" {
+		f, err := os.Open(u.path)
+		if err != nil {
+			return nil, err
+		}
+		return &autoCloser{f: f}, nil
+	}
+	if u.r == nil {
+		return nil, errors.New("mathpix: upload has no path or reader")
+	}
+	r := u.r
+	u.r = nil
+	return io.NopCloser(r), nil
+}
+
+// autoCloser is a file closing itself when a read returns an error,
+// including io.EOF.
+type autoCloser struct {
+	f      *os.File
+	closed bool
+}
+
+// Read reads from the file, closing it on error.
+func (a *autoCloser) Read(p []byte) (int, error) {
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := a.f.Read(p)
+	if err != nil {
+		a.Close()
+	}
+	return n, err
+}
+
+// Close closes the file if it is still open.
+func (a *autoCloser) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	return a.f.Close()
+}
+
+// replayable reports whether the upload can be sent more than once.
+func (u *Upload) replayable() bool {
+	return u == nil || u.path != ""
+}
+
+// newUploadPayload creates a multipart payload for request that uploads file
+// and sends options as the JSON encoded options_json form field.
+func newUploadPayload(
+	request any,
+	file *Upload,
+	options any,
+) (*uploadPayload, error) {
+	b, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadPayload{
+		File:    file,
+		Options: string(b),
+		request: request,
+	}, nil
+}
+
+// replayable reports whether the payload can be sent more than once.
+func (p *uploadPayload) replayable() bool {
+	return p.File.replayable()
+}
+
+// stream returns the multipart body of the payload and its content type.
+//
+// The body is written by a goroutine as it is read. Closing the body stops
+// the goroutine and closes the uploaded file.
+func (p *uploadPayload) stream() (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(p.write(w))
+	}()
+	return pr, w.FormDataContentType()
+}
+
+// write writes the options and the file of the payload to w.
+func (p *uploadPayload) write(w *multipart.Writer) error {
+	if err := w.WriteField("options_json", p.Options); err != nil {
+		return err
+	}
+	r, err := p.File.MarshalFile()
+	if err != nil {
+		return fmt.Errorf("mathpix: upload %q: %w", p.File.Filename(), err)
+	}
+	defer r.Close()
+	part, err := w.CreateFormFile("file", p.File.Filename())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// newImageUploadPayload creates the multipart payload for an image upload.
+func newImageUploadPayload(request *ImageRequest) (*uploadPayload, error) {
+	file := UploadFile(request.File)
+	if request.Reader != nil {
+		file = UploadReader("image", request.Reader)
+	}
+	opts, err := imageUploadOptions(request)
+	if err != nil {
+		return nil, err
+	}
+	return newUploadPayload(request, file, opts)
+}
+
+// imageUploadOptions returns the options_json of an image upload: the
+// Options of the request, with its Metadata and Tags set at the top level.
+func imageUploadOptions(request *ImageRequest) (map[string]any, error) {
+	opts := make(map[string]any)
+	if request.Options != nil {
+		b, err := json.Marshal(request.Options)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &opts); err != nil {
+			return nil, err
+		}
+	}
+	if request.Metadata != nil {
+		opts["metadata"] = request.Metadata
+	}
+	if len(request.Tags) > 0 {
+		opts["tags"] = request.Tags
+	}
+	return opts, nil
+}
+
+// newDocumentUploadPayload creates the multipart payload for a document
+// upload.
+func newDocumentUploadPayload(
+	request *RequestDocument,
+) (*uploadPayload, error) {
+	file := UploadFile(request.File)
+	if request.Reader != nil {
+		file = UploadReader(request.Filename, request.Reader)
+	}
+	if _, ok := ParseInputFormat(file.Filename()); !ok {
+		return nil, fmt.Errorf(
+			"mathpix: unsupported document format: %q",
+			file.Filename(),
+		)
+	}
+	opts := *request
+	opts.URL = ""
+	return newUploadPayload(request, file, &opts)
+}
+
+// newTextUploadPayload creates the multipart payload for a v3/text upload.
+func newTextUploadPayload(request *TextRequest) (*uploadPayload, error) {
+	file := UploadFile(request.File)
+	if request.Reader != nil {
+		file = UploadReader("image", request.Reader)
+	}
+	opts := *request
+	opts.SourceURL = ""
+	return newUploadPayload(request, file, &opts)
+}
@@ -0,0 +1,192 @@
+package mathpix_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+func TestImageUploadFile(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	path := writeFile(t, "eq.png", "png data")
+	client := srv.Client()
+
+	before := openFiles(t)
+	for range 20 {
+		if _, err := client.Image(context.Background(), &mathpix.ImageRequest{
+			File: path,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitOpenFiles(t, before)
+
+	reqs := srv.RequestsTo("v3/image")
+	if len(reqs) != 20 {
+		t.Fatalf("got %d requests, want 20", len(reqs))
+	}
+	if got := string(reqs[0].File); got != "png data" {
+		t.Errorf("uploaded %q, want %q", got, "png data")
+	}
+	if reqs[0].Filename != "eq.png" {
+		t.Errorf("filename %q, want %q", reqs[0].Filename, "eq.png")
+	}
+}
+
+func TestImageUploadOptions(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+
+	_, err := srv.Client().Image(context.Background(), &mathpix.ImageRequest{
+		File:     writeFile(t, "eq.png", "png data"),
+		Options:  &mathpix.RequestDocument{Streaming: true},
+		Metadata: map[string]string{"a": "b"},
+		Tags:     []string{"exam"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := srv.RequestsTo("v3/image")
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	var opts map[string]any
+	if err = json.Unmarshal(reqs[0].Options, &opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := opts["options_json"]; ok {
+		t.Errorf("options_json is nested: %s", reqs[0].Options)
+	}
+	for key, want := range map[string]string{
+		"streaming": "true",
+		"metadata":  "map[a:b]",
+		"tags":      "[exam]",
+	} {
+		if got := fmt.Sprint(opts[key]); got != want {
+			t.Errorf("got %s %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestImageUploadRetry(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("v3/image", mathpixtest.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       `{"error":"unavailable"}`,
+	})
+	path := writeFile(t, "eq.png", "png data")
+	client := srv.Client(mathpix.WithRetryPolicy(&mathpix.RetryPolicy{
+		MaxAttempts:        2,
+		RetryNonIdempotent: true,
+	}))
+
+	before := openFiles(t)
+	if _, err := client.Image(context.Background(), &mathpix.ImageRequest{
+		File: path,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitOpenFiles(t, before)
+
+	reqs := srv.RequestsTo("v3/image")
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	for i, req := range reqs {
+		if got := string(req.File); got != "png data" {
+			t.Errorf("attempt %d uploaded %q, want %q", i+1, got, "png data")
+		}
+	}
+}
+
+func TestImageUploadAbandoned(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	path := writeFile(t, "eq.png", string(bytes.Repeat([]byte("x"), 1<<20)))
+	errAbandoned := errors.New("abandoned")
+	// The middleware gives up after reading the start of the body.
+	client := srv.Client(mathpix.WithMiddleware(func(mathpix.Doer) mathpix.Doer {
+		return mathpix.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			_, _ = io.ReadFull(req.Body, make([]byte, 512))
+			return nil, errAbandoned
+		})
+	}))
+
+	before := openFiles(t)
+	for range 10 {
+		_, err := client.Image(context.Background(), &mathpix.ImageRequest{
+			File: path,
+		})
+		if !errors.Is(err, errAbandoned) {
+			t.Fatalf("got error %v, want %v", err, errAbandoned)
+		}
+	}
+	waitOpenFiles(t, before)
+}
+
+func TestPdfUploadUnsupportedFormat(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+
+	_, err := srv.Client().Pdf(context.Background(), &mathpix.RequestDocument{
+		File: writeFile(t, "notes.xyz", "data"),
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("sent %d requests, want 0", n)
+	}
+}
+
+// writeFile writes a file with the given name and content to a temporary
+// directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openFiles returns the number of open file descriptors of the process.
+//
+// The test is skipped where they cannot be listed.
+func openFiles(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("cannot list open files:", err)
+	}
+	return len(fds)
+}
+
+// waitOpenFiles fails the test if the number of open file descriptors does
+// not settle back to at most want plus a few for idle connections.
+func waitOpenFiles(t *testing.T, want int) {
+	t.Helper()
+	const slack = 4
+	var got int
+	for range 50 {
+		if got = openFiles(t); got <= want+slack {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("%d files open, want at most %d", got, want+slack)
+}
@@ -0,0 +1,247 @@
+package mathpix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// WaitOptions configures how a conversion is polled until it is done.
+	WaitOptions struct {
+		// Interval is the delay before the first poll.
+		// Defaults to one second.
+		Interval time.Duration
+		// MaxInterval caps the delay between two polls.
+		// Defaults to 30 seconds.
+		MaxInterval time.Duration
+		// Multiplier grows the interval after each poll.
+		// Values below 1 keep the interval constant.
+		Multiplier float64
+		// Formats are the conversion formats that must be done before
+		// returning. If empty, every format reported by the API must be done.
+		Formats []DocumentOutputFormat
+		// OnProgress is called with the result of every poll.
+		OnProgress func(*ConversionResultResponse)
+	}
+	// ConversionError is returned when a document conversion fails.
+	ConversionError struct {
+		// PDFID is the id of the failed document.
+		PDFID string
+		// Format is the conversion format that failed.
+		// Empty when the document itself failed to process.
+		Format DocumentOutputFormat
+		// Result is the last polled result.
+		Result *ConversionResultResponse
+		// Err is the error reported along with the result, if any.
+		Err error
+	}
+)
+
+// Error implements the error interface for ConversionError.
+func (e *ConversionError) Error() string {
+	msg := fmt.Sprintf("mathpix: conversion of %s failed", e.PDFID)
+	if e.Format != "" {
+		msg = fmt.Sprintf(
+			"mathpix: conversion of %s to %s failed",
+			e.PDFID,
+			e.Format,
+		)
+	}
+	if e.Err != nil {
+		msg += ": " + errorMessage(e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the error reported along with the result.
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// errorMessage returns the message of the API error wrapped by err, or the
+// message of err itself.
+func errorMessage(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Error()
+	}
+	return err.Error()
+}
+
+// WaitForPdf polls PdfResult until the document and all requested
+// conversion formats are done.
+//
+// It returns a *ConversionError if the document or a requested format
+// failed to convert. Errors reported in successful status responses are
+// wrapped by the *ConversionError instead of stopping the polling. Once the
+// document is processed, awaiting a format it was not converted to returns
+// ErrFormatNotRequested.
+func (c *Client) WaitForPdf(
+	ctx context.Context,
+	pdfID string,
+	opts *WaitOptions,
+) (*ConversionResultResponse, error) {
+	if opts == nil {
+		opts = &WaitOptions{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxInterval := opts.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = 30 * time.Second
+	}
+	for {
+		result, err := c.PdfResult(ctx, &ResultRequest{PDFID: pdfID})
+		if err != nil && !IsPartial(err) {
+			return nil, err
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(result)
+		}
+		formats := opts.Formats
+		if len(formats) == 0 {
+			for format := range result.Coversions {
+				formats = append(formats, format)
+			}
+		}
+		done, err := conversionDone(pdfID, result, formats, err)
+		if done || err != nil {
+			return result, err
+		}
+		if err = sleep(ctx, interval); err != nil {
+			return result, err
+		}
+		if opts.Multiplier > 1 {
+			interval = min(
+				time.Duration(float64(interval)*opts.Multiplier),
+				maxInterval,
+			)
+		}
+	}
+}
+
+// conversionDone reports whether the document and the given formats are
+// done converting.
+//
+// It returns a *ConversionError wrapping cause, the partial error returned
+// with the result, if the document or one of the formats failed. A result
+// with an error but no status is a failed document. A format missing from
+// the result of a processed document was never requested, and is reported
+// as ErrFormatNotRequested. mmd is done as soon as the document itself is
+// processed.
+func conversionDone(
+	pdfID string,
+	result *ConversionResultResponse,
+	formats []DocumentOutputFormat,
+	cause error,
+) (bool, error) {
+	switch {
+	case result.Status == ConversionStatusError,
+		result.Status == "" && cause != nil:
+		return true, &ConversionError{PDFID: pdfID, Result: result, Err: cause}
+	case result.Status != ConversionStatusCompleted:
+		return false, nil
+	}
+	for _, format := range formats {
+		if format == DocumentFormatMMD {
+			continue
+		}
+		status, ok := result.Coversions[format.conversionKey()]
+		if !ok {
+			return true, fmt.Errorf(
+				"%w: %s of %s",
+				ErrFormatNotRequested,
+				format,
+				pdfID,
+			)
+		}
+		switch status.Status {
+		case ConversionStatusError:
+			return true, &ConversionError{
+				PDFID:  pdfID,
+				Format: format,
+				Result: result,
+				Err:    cause,
+			}
+		case ConversionStatusCompleted:
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// WaitForBatch polls GetBatch until every URL of the batch has a result.
+//
+// keys are the keys of the RequestPostBatch.URLs the batch was submitted
+// with. If none are given, the keys reported by Mathpix are awaited
+// instead, and the batch is polled again as long as it reports none.
+//
+// Polls are spaced by about one second for every five pending images, as
+// recommended by Mathpix. If the context is done first, the last polled
+// response is returned with the partial results alongside the context
+// error.
+func (c *Client) WaitForBatch(
+	ctx context.Context,
+	batchID string,
+	keys ...string,
+) (*GetBatchResponse, error) {
+	var last *GetBatchResponse
+	for {
+		result, err := c.GetBatch(ctx, batchID)
+		if err != nil {
+			if ctx.Err() != nil && last != nil {
+				return last, ctx.Err()
+			}
+			return result, err
+		}
+		last = result
+		if batchDone(result, keys) {
+			return result, nil
+		}
+		pending := len(result.Pending(keys...))
+		if err = sleep(ctx, batchInterval(pending)); err != nil {
+			return result, err
+		}
+	}
+}
+
+// Pending returns the keys that have no result yet among the given keys,
+// or among the keys of the batch if none are given.
+func (r *GetBatchResponse) Pending(keys ...string) []string {
+	if len(keys) == 0 {
+		keys = r.Keys
+	}
+	var pending []string
+	for _, key := range keys {
+		if _, ok := r.Results[key]; !ok {
+			pending = append(pending, key)
+		}
+	}
+	return pending
+}
+
+// batchDone reports whether every one of the given keys, or of the keys of
+// the batch if none are given, has a result.
+//
+// A batch without any known key is never done, since Mathpix may omit the
+// keys of a batch it has not started processing.
+func batchDone(r *GetBatchResponse, keys []string) bool {
+	if len(keys) == 0 && len(r.Keys) == 0 {
+		return false
+	}
+	return len(r.Pending(keys...)) == 0
+}
+
+// batchInterval returns the delay before polling a batch with the given
+// number of pending images again.
+func batchInterval(pending int) time.Duration {
+	return min(
+		max(time.Duration(pending)*time.Second/5, time.Second),
+		30*time.Second,
+	)
+}
@@ -0,0 +1,219 @@
+package mathpix_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/mathpixtest"
+)
+
+// fastWait polls without waiting between polls.
+var fastWait = &mathpix.WaitOptions{Interval: time.Millisecond}
+
+func TestWaitForPdf(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.AddDocument("doc", mathpixtest.Document{
+		Pages: []string{"# Title"},
+		Polls: 2,
+	}, mathpix.DocumentFormatDOCX)
+	polls := 0
+	opts := *fastWait
+	opts.OnProgress = func(*mathpix.ConversionResultResponse) { polls++ }
+
+	result, err := srv.Client().WaitForPdf(context.Background(), "doc", &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != mathpix.ConversionStatusCompleted {
+		t.Errorf("status %q, want %q", result.Status, mathpix.ConversionStatusCompleted)
+	}
+	if polls != 3 {
+		t.Errorf("polled %d times, want 3", polls)
+	}
+}
+
+func TestWaitForPdfFailedFormat(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.AddDocument("doc", mathpixtest.Document{
+		Pages:         []string{"# Title"},
+		FailedFormats: []mathpix.DocumentOutputFormat{mathpix.DocumentFormatDOCX},
+	}, mathpix.DocumentFormatDOCX)
+
+	_, err := srv.Client().WaitForPdf(context.Background(), "doc", fastWait)
+	var convErr *mathpix.ConversionError
+	if !errors.As(err, &convErr) {
+		t.Fatalf("got error %v, want a *ConversionError", err)
+	}
+	if convErr.Format != mathpix.DocumentFormatDOCX {
+		t.Errorf("failed format %q, want %q", convErr.Format, mathpix.DocumentFormatDOCX)
+	}
+}
+
+func TestWaitForPdfFormats(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		formats []mathpix.DocumentOutputFormat
+		want    error
+	}{
+		{"mmd", []mathpix.DocumentOutputFormat{mathpix.DocumentFormatMMD}, nil},
+		{
+			"not requested",
+			[]mathpix.DocumentOutputFormat{mathpix.DocumentFormatHTML},
+			mathpix.ErrFormatNotRequested,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := mathpixtest.NewServer()
+			defer srv.Close()
+			srv.AddDocument("doc", mathpixtest.Document{
+				Pages: []string{"# Title"},
+				Polls: 1,
+			}, mathpix.DocumentFormatDOCX)
+			opts := *fastWait
+			opts.Formats = tt.formats
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := srv.Client().WaitForPdf(ctx, "doc", &opts)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+			if n := len(srv.RequestsTo("v3/status")); n != 2 {
+				t.Errorf("polled %d times, want 2", n)
+			}
+		})
+	}
+}
+
+func TestWaitForPdfErrorStatus(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("v3/status", mathpixtest.Response{
+		Body: `{"status":"error","error":"PDF could not be processed"}`,
+	})
+
+	result, err := srv.Client().WaitForPdf(context.Background(), "doc", fastWait)
+	var convErr *mathpix.ConversionError
+	if !errors.As(err, &convErr) {
+		t.Fatalf("got error %v, want a *ConversionError", err)
+	}
+	if result == nil || result.Status != mathpix.ConversionStatusError {
+		t.Errorf("got result %+v, want the error status", result)
+	}
+	want := "mathpix: conversion of doc failed: PDF could not be processed"
+	if got := err.Error(); got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
+
+func TestWaitForPdfUnknownID(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+
+	_, err := srv.Client().WaitForPdf(context.Background(), "missing", fastWait)
+	if !errors.Is(err, mathpix.ErrPDFUnknownID) {
+		t.Fatalf("got error %v, want %v", err, mathpix.ErrPDFUnknownID)
+	}
+}
+
+func TestDownloadPdfResultErrorStatus(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.Respond("v3/status", mathpixtest.Response{
+		Body: `{"status":"error","error":"PDF could not be processed"}`,
+	})
+
+	var buf bytes.Buffer
+	err := srv.Client().DownloadPdfResult(
+		context.Background(),
+		"doc",
+		mathpix.DocumentFormatMMD,
+		&buf,
+	)
+	var convErr *mathpix.ConversionError
+	if !errors.As(err, &convErr) {
+		t.Fatalf("got error %v, want a *ConversionError", err)
+	}
+}
+
+func TestDownloadPdfResultFormatNotRequested(t *testing.T) {
+	srv := mathpixtest.NewServer()
+	defer srv.Close()
+	srv.AddDocument("doc", mathpixtest.Document{
+		Pages: []string{"# Title"},
+		Polls: 1,
+	})
+	client := srv.Client()
+
+	for _, want := range []error{
+		mathpix.ErrConversionPending,
+		mathpix.ErrFormatNotRequested,
+	} {
+		var buf bytes.Buffer
+		err := client.DownloadPdfResult(
+			context.Background(),
+			"doc",
+			mathpix.DocumentFormatDOCX,
+			&buf,
+		)
+		if !errors.Is(err, want) {
+			t.Fatalf("got error %v, want %v", err, want)
+		}
+	}
+}
+
+func TestWaitForBatch(t *testing.T) {
+	srv := mathpixtest.NewServer(mathpixtest.WithBatchPolls(0))
+	defer srv.Close()
+	client := srv.Client()
+	urls := map[string]string{
+		"a": "https://example.com/a.png",
+		"b": "https://example.com/b.png",
+	}
+	batch, err := client.Batch(context.Background(), &mathpix.RequestPostBatch{URLs: urls})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first poll reports an incomplete list of keys.
+	srv.Respond("GET v3/batch", mathpixtest.Response{
+		Body: `{"keys":["a"],"results":{"a":{"text":"x"}}}`,
+	})
+
+	result, err := client.WaitForBatch(context.Background(), batch.BatchID, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 2 {
+		t.Errorf("got %d results, want 2", len(result.Results))
+	}
+	if n := len(srv.RequestsTo("GET v3/batch")); n != 2 {
+		t.Errorf("polled %d times, want 2", n)
+	}
+}
+
+func TestWaitForBatchWithoutKeys(t *testing.T) {
+	srv := mathpixtest.NewServer(mathpixtest.WithBatchPolls(0))
+	defer srv.Close()
+	client := srv.Client()
+	batch, err := client.Batch(context.Background(), &mathpix.RequestPostBatch{
+		URLs: map[string]string{"a": "https://example.com/a.png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Respond("GET v3/batch", mathpixtest.Response{Body: `{"results":{}}`})
+
+	result, err := client.WaitForBatch(context.Background(), batch.BatchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 1 {
+		t.Errorf("got %d results, want 1", len(result.Results))
+	}
+}
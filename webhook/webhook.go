@@ -0,0 +1,255 @@
+// Package webhook receives the callbacks Mathpix sends when a PDF
+// conversion progresses.
+//
+// A Receiver is an http.Handler decoding callbacks into Events and
+// dispatching them to the registered handlers:
+//
+//	rcv := webhook.NewReceiver(webhook.WithSecret("X-Webhook-Secret", secret))
+//	rcv.HandleFunc(mathpix.ConversionStatusCompleted, func(ctx context.Context, ev *webhook.Event) error {
+//		return download(ctx, ev.PDFID)
+//	})
+//	http.Handle("/mathpix", rcv)
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+)
+
+const (
+	// maxBody is the largest callback body accepted by a Receiver.
+	maxBody = 1 << 20
+	// defaultDedupeWindow is how long deliveries are remembered by default.
+	defaultDedupeWindow = time.Hour
+)
+
+type (
+	// Event is a decoded PDF conversion callback.
+	Event struct {
+		// PDFID is the id of the converted document.
+		PDFID string `json:"pdf_id"`
+		// ConversionResultResponse holds the status of the document and of
+		// its conversion formats.
+		mathpix.ConversionResultResponse
+		// Body is the raw callback body.
+		Body []byte `json:"-"`
+	}
+	// Handler handles callback events.
+	Handler interface {
+		// HandleEvent handles ev. Returning an error answers the callback
+		// with 500, so that the delivery can be retried.
+		HandleEvent(ctx context.Context, ev *Event) error
+	}
+	// HandlerFunc is an adapter to allow the use of ordinary functions as
+	// Handlers.
+	HandlerFunc func(ctx context.Context, ev *Event) error
+	// Receiver is an http.Handler receiving PDF conversion callbacks.
+	//
+	// It is safe for concurrent use.
+	Receiver struct {
+		// authenticate is set by WithSecret, even if its header or secret
+		// are empty.
+		authenticate bool
+		secretHeader string
+		secret       string
+		window       time.Duration
+
+		mu       sync.Mutex
+		handlers []route
+		seen     map[string]time.Time
+	}
+	// Option configures a Receiver.
+	Option func(*Receiver)
+	// route is a handler registered for a status.
+	route struct {
+		status  mathpix.ConversionStatusType
+		handler Handler
+	}
+)
+
+// NewReceiver creates a new Receiver.
+func NewReceiver(opts ...Option) *Receiver {
+	r := &Receiver{
+		window: defaultDedupeWindow,
+		seen:   make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithSecret makes the Receiver reject callbacks whose header does not
+// carry the shared secret.
+//
+// An empty header or secret, e.g. read from an unset environment variable,
+// rejects every callback instead of disabling authentication.
+func WithSecret(header, secret string) Option {
+	return func(r *Receiver) {
+		r.authenticate = true
+		r.secretHeader = header
+		r.secret = secret
+	}
+}
+
+// WithDedupeWindow sets how long successfully handled deliveries are
+// remembered to ignore repeated deliveries of the same callback.
+// Defaults to one hour. Zero or a negative window disables deduplication.
+func WithDedupeWindow(window time.Duration) Option {
+	return func(r *Receiver) { r.window = window }
+}
+
+// HandleEvent calls f(ctx, ev).
+func (f HandlerFunc) HandleEvent(ctx context.Context, ev *Event) error {
+	return f(ctx, ev)
+}
+
+// Handle registers h for the events with the given document status.
+// An empty status registers h for every event.
+//
+// Handlers are called in the order they are registered.
+func (r *Receiver) Handle(status mathpix.ConversionStatusType, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, route{status: status, handler: h})
+}
+
+// HandleFunc registers f for the events with the given document status.
+func (r *Receiver) HandleFunc(
+	status mathpix.ConversionStatusType,
+	f func(ctx context.Context, ev *Event) error,
+) {
+	r.Handle(status, HandlerFunc(f))
+}
+
+// ServeHTTP implements http.Handler.
+//
+// Repeated deliveries of a handled callback are acknowledged without
+// dispatching them again.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ev, err := decode(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := deliveryKey(ev.Body)
+	if !r.claim(key) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err = r.dispatch(req.Context(), ev); err != nil {
+		r.release(key)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorized reports whether req carries the shared secret, if any.
+//
+// Empty headers and secrets never match, so that a missing header is not
+// mistaken for an empty secret.
+func (r *Receiver) authorized(req *http.Request) bool {
+	if !r.authenticate {
+		return true
+	}
+	if r.secretHeader == "" {
+		return false
+	}
+	got := req.Header.Get(r.secretHeader)
+	return got != "" && r.secret != "" &&
+		subtle.ConstantTimeCompare([]byte(got), []byte(r.secret)) == 1
+}
+
+// dispatch calls the handlers registered for the event, stopping at the
+// first error.
+func (r *Receiver) dispatch(ctx context.Context, ev *Event) error {
+	r.mu.Lock()
+	routes := append([]route(nil), r.handlers...)
+	r.mu.Unlock()
+	for _, rt := range routes {
+		if rt.status != "" && rt.status != ev.Status {
+			continue
+		}
+		if err := rt.handler.HandleEvent(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claim marks the delivery with the given key as seen and reports whether
+// it was not seen before.
+//
+// Expired deliveries are forgotten.
+func (r *Receiver) claim(key string) bool {
+	if r.window <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for k, at := range r.seen {
+		if now.Sub(at) > r.window {
+			delete(r.seen, k)
+		}
+	}
+	if _, ok := r.seen[key]; ok {
+		return false
+	}
+	r.seen[key] = now
+	return true
+}
+
+// release forgets the delivery with the given key, so that it is handled
+// again when redelivered.
+func (r *Receiver) release(key string) {
+	if r.window <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.seen, key)
+}
+
+// decode reads an Event from a callback body.
+func decode(body io.Reader) (*Event, error) {
+	b, err := io.ReadAll(io.LimitReader(body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+	var ev Event
+	if err = json.Unmarshal(b, &ev); err != nil {
+		return nil, errors.New("webhook: invalid callback body")
+	}
+	if ev.PDFID == "" {
+		return nil, errors.New("webhook: callback has no pdf_id")
+	}
+	ev.Body = b
+	return &ev, nil
+}
+
+// deliveryKey identifies a delivery by the hash of its body.
+func deliveryKey(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
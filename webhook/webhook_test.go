@@ -0,0 +1,102 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mathpix "github.com/conneroisu/mathpix-go"
+	"github.com/conneroisu/mathpix-go/webhook"
+)
+
+const completed = `{"pdf_id":"doc","status":"completed"}`
+
+// post delivers body to h with the given headers and returns the status
+// code of the response.
+func post(h http.Handler, body string, header http.Header) int {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestReceiverSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		secret string
+		header http.Header
+		want   int
+	}{
+		{"valid", "X-Secret", "s3cret", http.Header{"X-Secret": {"s3cret"}}, http.StatusOK},
+		{"wrong", "X-Secret", "s3cret", http.Header{"X-Secret": {"nope"}}, http.StatusUnauthorized},
+		{"missing", "X-Secret", "s3cret", nil, http.StatusUnauthorized},
+		{"empty secret", "X-Secret", "", nil, http.StatusUnauthorized},
+		{"empty secret and header", "X-Secret", "", http.Header{"X-Secret": {""}}, http.StatusUnauthorized},
+		{"empty header name", "", "s3cret", http.Header{"X-Secret": {"s3cret"}}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := webhook.NewReceiver(webhook.WithSecret(tt.key, tt.secret))
+			if got := post(rcv, completed, tt.header); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiverDispatch(t *testing.T) {
+	rcv := webhook.NewReceiver()
+	var got []string
+	rcv.HandleFunc(mathpix.ConversionStatusCompleted,
+		func(_ context.Context, ev *webhook.Event) error {
+			got = append(got, ev.PDFID)
+			return nil
+		},
+	)
+	rcv.HandleFunc(mathpix.ConversionStatusError,
+		func(context.Context, *webhook.Event) error {
+			t.Error("error handler called for a completed document")
+			return nil
+		},
+	)
+
+	if code := post(rcv, completed, nil); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	// Repeated deliveries are acknowledged without being dispatched.
+	if code := post(rcv, completed, nil); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if len(got) != 1 || got[0] != "doc" {
+		t.Errorf("dispatched %q, want [doc]", got)
+	}
+}
+
+func TestReceiverRedeliversFailures(t *testing.T) {
+	rcv := webhook.NewReceiver()
+	calls := 0
+	rcv.HandleFunc("", func(context.Context, *webhook.Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("busy")
+		}
+		return nil
+	})
+
+	if code := post(rcv, completed, nil); code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", code, http.StatusInternalServerError)
+	}
+	if code := post(rcv, completed, nil); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}